@@ -0,0 +1,69 @@
+package chess
+
+import (
+	"math/bits"
+)
+
+// Bitboard squares are numbered row*8+col, so a1 is bit 0, h1 is bit 7 and h8 is bit 63
+const (
+	rank1 = uint64(0xFF)
+	rank8 = rank1 << 56
+	// b1, d1, ..., a2, c2, ...
+	lightSquares = uint64(0x55AA55AA55AA55AA)
+)
+
+var knightAttacks [64]uint64
+var kingAttacks [64]uint64
+
+// pawnAttacks is indexed by color (see colorIndex) and by the square of the pawn
+var pawnAttacks [2][64]uint64
+
+func init() {
+	for sq := uint8(0); sq < 64; sq++ {
+		row, col := int8(sq/8), int8(sq%8)
+
+		knightAttacks[sq] = squaresAround(row, col, [][2]int8{{1, 2}, {1, -2}, {-1, 2}, {-1, -2}, {2, 1}, {2, -1}, {-2, 1}, {-2, -1}})
+		kingAttacks[sq] = squaresAround(row, col, [][2]int8{{1, 0}, {1, 1}, {1, -1}, {-1, 0}, {-1, 1}, {-1, -1}, {0, 1}, {0, -1}})
+		pawnAttacks[colorIndex(true)][sq] = squaresAround(row, col, [][2]int8{{1, 1}, {1, -1}})
+		pawnAttacks[colorIndex(false)][sq] = squaresAround(row, col, [][2]int8{{-1, 1}, {-1, -1}})
+	}
+}
+
+func squaresAround(row, col int8, deltas [][2]int8) uint64 {
+	res := uint64(0)
+	for _, delta := range deltas {
+		r, c := row+delta[0], col+delta[1]
+		if isInsideBoard(r, c) {
+			res |= squareBit(uint8(r), uint8(c))
+		}
+	}
+	return res
+}
+
+func squareIndex(row, col uint8) uint8 {
+	return row*8 + col
+}
+
+func squareBit(row, col uint8) uint64 {
+	return uint64(1) << squareIndex(row, col)
+}
+
+// colorIndex is 1 for white and 0 for black, same as the zobrist turn indexes
+func colorIndex(isWhite bool) int {
+	if isWhite {
+		return whiteTurn
+	}
+	return blackTurn
+}
+
+// pieceIndex maps a piece bit to its bitboard index: pawn 0, knight 1, bishop 2, rook 3, queen 4, king 5
+func pieceIndex(piece uint8) int {
+	return bits.TrailingZeros8(piece)
+}
+
+// popLSB removes the lowest set bit from the bitboard and returns its square
+func popLSB(bb *uint64) uint8 {
+	sq := uint8(bits.TrailingZeros64(*bb))
+	*bb &= *bb - 1
+	return sq
+}
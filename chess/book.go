@@ -0,0 +1,116 @@
+package chess
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+)
+
+// polyglotEntrySize is the size of a book entry: key uint64, move uint16, weight uint16, learn uint32, all big endian
+const polyglotEntrySize = 16
+
+type bookEntry struct {
+	key    uint64
+	move   uint16
+	weight uint16
+}
+
+// Book is a Polyglot opening book loaded into memory. The entries are sorted by key.
+type Book struct {
+	entries []bookEntry
+}
+
+type BookMove struct {
+	Move   Move
+	Weight int
+}
+
+func OpenBook(path string) (*Book, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%polyglotEntrySize != 0 {
+		return nil, fmt.Errorf("invalid book %s: size %d is not a multiple of %d", path, len(data), polyglotEntrySize)
+	}
+
+	book := &Book{entries: make([]bookEntry, len(data)/polyglotEntrySize)}
+	for i := range book.entries {
+		entry := data[i*polyglotEntrySize:]
+		book.entries[i] = bookEntry{
+			key:    binary.BigEndian.Uint64(entry[0:8]),
+			move:   binary.BigEndian.Uint16(entry[8:10]),
+			weight: binary.BigEndian.Uint16(entry[10:12]),
+		}
+	}
+	return book, nil
+}
+
+// Moves returns the legal book moves of the position with their weights
+func (b *Book) Moves(p *Position) []BookMove {
+	key := p.PolyglotKey()
+	first := sort.Search(len(b.entries), func(i int) bool {
+		return b.entries[i].key >= key
+	})
+
+	var res []BookMove
+	legalMoves := p.GetAllMoves()
+	for i := first; i < len(b.entries) && b.entries[i].key == key; i++ {
+		if move, ok := decodeBookMove(b.entries[i].move, p, legalMoves); ok {
+			res = append(res, BookMove{Move: move, Weight: int(b.entries[i].weight)})
+		}
+	}
+	return res
+}
+
+// PickMove chooses one of the book moves of the position at random, in proportion to their weights
+func (b *Book) PickMove(p *Position) (Move, bool) {
+	moves := b.Moves(p)
+	total := 0
+	for _, bookMove := range moves {
+		total += bookMove.Weight
+	}
+	if total == 0 {
+		return Move{}, false
+	}
+
+	r := rand.Intn(total)
+	for _, bookMove := range moves {
+		if r < bookMove.Weight {
+			return bookMove.Move, true
+		}
+		r -= bookMove.Weight
+	}
+	return Move{}, false
+}
+
+// decodeBookMove finds the legal move encoded in a book entry:
+// to col bits 0-2, to row 3-5, from col 6-8, from row 9-11, promotion piece 12-14 (1 knight, 2 bishop, 3 rook, 4 queen).
+// Castling is encoded as the king capturing its own rook, e.g. e1h1.
+func decodeBookMove(encoded uint16, p *Position, legalMoves []Move) (Move, bool) {
+	toCol, toRow := uint8(encoded&7), uint8(encoded>>3&7)
+	fromCol, fromRow := uint8(encoded>>6&7), uint8(encoded>>9&7)
+	var promotePiece uint8
+	if promotion := encoded >> 12 & 7; promotion != 0 {
+		promotePiece = KnightBit << (promotion - 1)
+	}
+
+	if piece, _ := getPiece(fromRow, fromCol, p); piece == KingBit && fromCol == 4 && fromRow == toRow {
+		switch toCol {
+		case 7:
+			toCol = 6
+		case 0:
+			toCol = 2
+		}
+	}
+
+	for _, move := range legalMoves {
+		if move.fromRow == fromRow && move.fromCol == fromCol && move.toRow == toRow && move.toCol == toCol &&
+			move.pawnPromotePiece & ^isWhiteBit == promotePiece {
+			return move, true
+		}
+	}
+	return Move{}, false
+}
@@ -0,0 +1,119 @@
+package chess
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// writeTestBook writes a Polyglot book with the entries sorted by key, as the format requires
+func writeTestBook(t *testing.T, entries []bookEntry) string {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+	data := make([]byte, 0, len(entries)*polyglotEntrySize)
+	for _, entry := range entries {
+		data = binary.BigEndian.AppendUint64(data, entry.key)
+		data = binary.BigEndian.AppendUint16(data, entry.move)
+		data = binary.BigEndian.AppendUint16(data, entry.weight)
+		data = binary.BigEndian.AppendUint32(data, 0)
+	}
+	path := filepath.Join(t.TempDir(), "book.bin")
+	if err := os.WriteFile(path, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func encodeBookMove(uciMove string) uint16 {
+	encoded := uint16(uciMove[2]-'a') | uint16(uciMove[3]-'1')<<3 | uint16(uciMove[0]-'a')<<6 | uint16(uciMove[1]-'1')<<9
+	if len(uciMove) == 5 {
+		encoded |= uint16(map[byte]uint16{'n': 1, 'b': 2, 'r': 3, 'q': 4}[uciMove[4]]) << 12
+	}
+	return encoded
+}
+
+func TestBookMoves(t *testing.T) {
+	start := mustParseFEN(t, StartFEN)
+	castling := mustParseFEN(t, "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1")
+	promotion := mustParseFEN(t, "8/1P2k3/8/8/8/8/8/4K3 w - - 0 1")
+
+	path := writeTestBook(t, []bookEntry{
+		{key: start.PolyglotKey(), move: encodeBookMove("e2e4"), weight: 3},
+		{key: start.PolyglotKey(), move: encodeBookMove("d2d4"), weight: 1},
+		// illegal moves are skipped
+		{key: start.PolyglotKey(), move: encodeBookMove("e2e5"), weight: 10},
+		{key: castling.PolyglotKey(), move: encodeBookMove("e1h1"), weight: 1},
+		{key: castling.PolyglotKey(), move: encodeBookMove("e1a1"), weight: 1},
+		{key: promotion.PolyglotKey(), move: encodeBookMove("b7b8n"), weight: 1},
+	})
+	book, err := OpenBook(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		p        *Position
+		expected map[string]int
+	}{
+		{start, map[string]int{"e2e4": 3, "d2d4": 1}},
+		{castling, map[string]int{"e1g1": 1, "e1c1": 1}},
+		{promotion, map[string]int{"b7b8n": 1}},
+		{mustParseFEN(t, "r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1"), map[string]int{}},
+	}
+	for _, tt := range tests {
+		moves := book.Moves(tt.p)
+		res := make(map[string]int)
+		for _, bookMove := range moves {
+			res[moveToUCI(bookMove.Move)] = bookMove.Weight
+		}
+		if len(res) != len(tt.expected) {
+			t.Errorf("%s: expected book moves %v, got %v", tt.p.FEN(), tt.expected, res)
+			continue
+		}
+		for uciMove, weight := range tt.expected {
+			if res[uciMove] != weight {
+				t.Errorf("%s: expected book moves %v, got %v", tt.p.FEN(), tt.expected, res)
+			}
+		}
+	}
+
+	if _, err := OpenBook(filepath.Join(t.TempDir(), "missing.bin")); err == nil {
+		t.Errorf("expected an error for a missing book")
+	}
+}
+
+func TestGoPlaysBookMove(t *testing.T) {
+	setup()
+	start := mustParseFEN(t, StartFEN)
+	path := writeTestBook(t, []bookEntry{
+		{key: start.PolyglotKey(), move: encodeBookMove("g1f3"), weight: 1},
+	})
+	defer setBookFile("")
+
+	e, out := newTestEngine()
+	e.HandleCommand("setoption name Book value " + path)
+	e.HandleCommand("ucinewgame")
+	e.HandleCommand("position startpos")
+	e.HandleCommand("go")
+	e.waitSearch()
+	if lastCommand := bestMove(out); lastCommand != "g1f3" {
+		t.Errorf("expected the book move, got %q", lastCommand)
+	}
+
+	// out of the book the engine searches
+	e.HandleCommand("position startpos moves g1f3")
+	e.HandleCommand("go")
+	e.waitSearch()
+	if len(e.game.moves) != 2 {
+		t.Errorf("expected the engine to make a move out of the book")
+	}
+
+	e.HandleCommand("setoption name OwnBook value false")
+	if OwnBook {
+		t.Errorf("expected OwnBook to be disabled")
+	}
+	OwnBook = true
+}
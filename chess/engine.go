@@ -1,93 +1,178 @@
 package chess
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"math"
+	"slices"
 	"sort"
 	"time"
 )
 
-func MakeMove(treeDepth int, game *Game) ([]*Move, float32) {
-	/**
-	Returns sequence of best moves
-	*/
+// nullWindow is the width of the windows that only test whether a move is better than the best one so far
+const nullWindow = Score(1)
+
+// aspirationWindow is the initial distance of the bounds of an iteration from the evaluation of the previous one
+const aspirationWindow = PawnScore / 2
+
+// MakeMove searches the position with iterative deepening, one ply deeper each iteration until treeDepth,
+// or until the search reaches one of game.limits when they are set. Returns the principal variation
+// of the last completed iteration. With more than one thread, helpers search along, see smp.go.
+func MakeMove(treeDepth int, game *Game) ([]*Move, Score) {
+	return MakeMoveContext(context.Background(), treeDepth, game)
+}
+
+// MakeMoveContext is MakeMove that stops searching once ctx is done. The first iteration still completes,
+// so there is always a move to play.
+func MakeMoveContext(ctx context.Context, treeDepth int, game *Game) ([]*Move, Score) {
 	p := game.position
-	start := time.Now()
-	parent := Node{
-		parent:         nil,
-		children:       nil,
-		move:           nil,
-		bestChild:      nil,
-		treeNodesCount: 1,
-		treeEvaluation: GetWorstEvaluation(p.whiteTurn),
-	}
+	game.timer = newTimeManager(game.limits.TimeControl, p.whiteTurn)
+	game.timer.maxNodes = game.limits.Nodes
+	game.timer.ponderhit = game.ponderhit
+	treeDepth = game.limits.maxDepth(treeDepth)
+	abort := game.timer.abort
+	defer context.AfterFunc(ctx, func() { abort.Store(true) })()
+	game.history.startSearch()
+	transpositionTable.newSearch()
+	game.ordering.newSearch()
 
-	game.MinimaxTree(&parent, p, treeDepth, -math.MaxFloat32, math.MaxFloat32)
-	if parent.bestChild == nil {
-		log.Println("ERROR: Didn't find best child node")
-	}
+	helpers := game.startHelpers(treeDepth)
+	result := game.iterativeDeepening(treeDepth, 1)
+	helpers.stop(game)
+	return result.moves, result.eval
+}
 
-	if Debug {
-		fmt.Println(" --- Printing Best Child --- ")
-		PrintNode(parent.bestChild, p)
+// searchResult is the principal variation and the evaluation of the deepest iteration a thread completed
+type searchResult struct {
+	moves []*Move
+	eval  Score
+}
+
+// iterativeDeepening runs the iterations of the search of a thread from startDepth on
+func (g *Game) iterativeDeepening(treeDepth int, startDepth int) searchResult {
+	result := searchResult{eval: GetWorstEvaluation(g.position.whiteTurn)}
+	for depth := startDepth; depth <= treeDepth; depth++ {
+		if depth > startDepth && !g.timer.canStartIteration() {
+			break
+		}
+		moves, eval, completed := searchDepth(depth, result.eval, g)
+		if !completed {
+			break
+		}
+		result = searchResult{moves: moves, eval: eval}
+		// deeper iterations can't find a shorter mate
+		if len(moves) == 0 || IsCheckmateEvaluation(eval) && checkmatePlies(eval) <= depth || g.limits.foundMate(eval, g.position.whiteTurn) {
+			break
+		}
 	}
-	bestMoves := make([]*Move, 0)
-	for currChild := &parent; currChild != nil; currChild = currChild.bestChild {
-		if currChild.move != nil {
-			bestMoves = append(bestMoves, currChild.move)
+	return result
+}
+
+// searchDepth runs a single iteration of iterative deepening. The first iteration of the main thread
+// always completes, the later ones are abandoned when the time runs out. With MultiPV, the best line
+// is searched again without its first move for every other line, the iteration returns the best line.
+func searchDepth(depth int, prevEval Score, game *Game) ([]*Move, Score, bool) {
+	p := game.position
+	start := time.Now()
+	startNodes := game.timer.nodes
+	game.selDepth = 0
+	game.timer.stopped = false
+	game.timer.canStop = depth > 1 || game.threadID > 0
+	game.timer.rootScored = false
+	game.rootExcluded = game.rootExcluded[:0]
+
+	var bestMoves []*Move
+	var bestEval Score
+	for line := 1; line <= max(game.multiPV, 1); line++ {
+		moves, eval, completed := searchLine(depth, prevEval, game)
+		if !completed && line == 1 {
+			log.Println("Depth", depth, "aborted after", game.timer.elapsed())
+			return nil, 0, false
+		}
+		// no root moves are left, or the time ran out for the other lines
+		if !completed || len(moves) == 0 {
+			break
+		}
+		if line == 1 {
+			bestMoves, bestEval = moves, eval
+		}
+		if game.output != nil {
+			game.output.send(game.infoLine(depth, line, eval, moves))
 		}
+		game.rootExcluded = append(game.rootExcluded, *moves[0])
+		prevEval = GetWorstEvaluation(p.whiteTurn)
+	}
+
+	if game.debug {
+		fmt.Println(" --- Printing Principal Variation --- ")
+		printLine(p, bestMoves)
 	}
 	took := time.Since(start).Seconds()
-	evalStr := fmt.Sprintf("%.2f", parent.treeEvaluation)
-	log.Println("Eval:", evalStr, "Tree size:", parent.treeNodesCount, ", took: ", int(took), ", speed=", int(float64(parent.treeNodesCount)/(1000*took)), "Knodes/sec")
-	return bestMoves, parent.treeEvaluation
+	nodes := game.timer.nodes - startNodes
+	log.Println("Depth:", depth, "Eval:", bestEval, "PV:", bestMoves, "Nodes:", nodes, ", took: ", int(took), ", speed=", int(float64(nodes)/(1000*took)), "Knodes/sec")
+	return bestMoves, bestEval, true
 }
 
-func generateNextMovePositions(p *Position, parent *Node) ([]*Node, []Position) {
-	moves := p.GetAllMoves()
-	if len(moves) == 0 {
-		return make([]*Node, 0), make([]Position, 0)
+// searchLine searches the root without the moves skipRootMove leaves out, within an aspiration window around
+// the evaluation of the previous iteration that is widened while the evaluation falls outside of it
+func searchLine(depth int, prevEval Score, game *Game) ([]*Move, Score, bool) {
+	// there is no previous evaluation in the first iteration of a thread
+	window := aspirationWindow
+	lowerBoundEval, upperBoundEval := LowestPositionScore, HighestPositionScore
+	if Abs(prevEval) < HighestPositionScore && !IsCheckmateEvaluation(prevEval) {
+		lowerBoundEval, upperBoundEval = prevEval-window, prevEval+window
 	}
 
-	p.availableMoves = moves
+	var eval Score
+	for {
+		eval = game.MinimaxTree(game.position, depth, lowerBoundEval, upperBoundEval)
+		if game.timer.stopped {
+			// the nodes limit stopped the first iteration, its best root move so far is the move to play
+			if !game.timer.canStop && game.timer.rootScored {
+				return game.pv.line(), eval, true
+			}
+			return nil, 0, false
+		}
 
-	positionMoves := p.applyMoves(moves)
-	sortPositions(positionMoves)
+		window *= 2
+		if eval <= lowerBoundEval && lowerBoundEval > LowestPositionScore {
+			lowerBoundEval = widenBound(eval-window, window)
+		} else if eval >= upperBoundEval && upperBoundEval < HighestPositionScore {
+			upperBoundEval = widenBound(eval+window, window)
+		} else {
+			break
+		}
+	}
 
-	var nodes = make([]*Node, len(positionMoves))
-	var positions = make([]Position, len(positionMoves))
+	return game.pv.line(), eval, true
+}
 
-	for i, posMove := range positionMoves {
-		if Debug {
-			//posMove.pos.PrintPosition()
-			fmt.Printf("Debug: %s\n", posMove.move.String())
-			//posMove.pos.PrintPosition()
-		}
-		eval := GetWorstEvaluation(posMove.pos.whiteTurn)
-		nodes[i] = &Node{
-			parent:         parent,
-			children:       nil,
-			move:           posMove.move,
-			treeNodesCount: 1,
-			treeEvaluation: eval,
+// widenBound gives up on the aspiration window once it is wider than a queen
+func widenBound(bound Score, window Score) Score {
+	if window > pieceCost[QueenBit] {
+		if bound < 0 {
+			return LowestPositionScore
 		}
-		positions[i] = *posMove.pos
+		return HighestPositionScore
 	}
-	return nodes, positions
+	return bound
 }
 
-func GetWorstEvaluation(whiteTurn bool) float32 {
-	eval := float32(math.MaxFloat32)
-	if whiteTurn {
-		eval = -math.MaxFloat32
+func printLine(p *Position, moves []*Move) {
+	newPos := ClonePosition(p)
+	for _, move := range moves {
+		ApplyMovePointers(newPos, move)
+		fmt.Printf("Move: %s\n", move.String())
 	}
-	return eval
+	newPos.PrintPosition()
 }
 
-type PositionMove struct {
-	pos  *Position
-	move *Move
+func GetWorstEvaluation(whiteTurn bool) Score {
+	eval := HighestPositionScore
+	if whiteTurn {
+		eval = LowestPositionScore
+	}
+	return eval
 }
 
 func (m Move) toInt() int {
@@ -98,10 +183,10 @@ func (m Move) toInt() int {
 	return int(m.fromRow) + int(m.fromCol)*8 + int(m.toRow)*8*8 + int(m.toCol)*8*8*8 + captureInt*8*8*8*8 + int(m.pawnPromotePiece)*8*8*8*8*8
 }
 
-func sortPositions(positionMoves []PositionMove) {
-	sort.SliceStable(positionMoves, func(i, j int) bool {
-		moveI := positionMoves[i].move
-		moveJ := positionMoves[j].move
+func sortMoves(moves []Move) {
+	sort.SliceStable(moves, func(i, j int) bool {
+		moveI := moves[i]
+		moveJ := moves[j]
 		if moveI.toInt() > moveJ.toInt() {
 			return true
 		}
@@ -110,89 +195,228 @@ func sortPositions(positionMoves []PositionMove) {
 
 }
 
-func (g *Game) MinimaxTree(currNode *Node, currPosition *Position, depth int, lowerBoundEval, upperBoundEval float32) {
+// MinimaxTree returns the evaluation of the position for white, searched depth plies deep, and fills the
+// principal variation of the ply. It is a principal variation search: the first move gets the full
+// alpha-beta window, the rest of the moves are only tested against a null window above (for white)
+// or below (for black) the best evaluation so far, and searched again with the full window when they
+// turn out better. Outside of the principal variation the search is selective, see pruning.go.
+func (g *Game) MinimaxTree(currPosition *Position, depth int, lowerBoundEval, upperBoundEval Score) Score {
+	ply := g.history.ply()
+	g.pv.clear(ply)
+	g.selDepth = max(g.selDepth, ply)
 
-	//if Debug {
-	//	log.Println("Current Position")
-	//	currPosition.PrintPosition()
-	//}
+	if g.timer.checkTime() {
+		return 0
+	}
+
+	if depth <= 0 {
+		return g.quiescence(currPosition, ply, lowerBoundEval, upperBoundEval)
+	}
 
-	if depth == 0 {
-		eval := currPosition.Evaluate(currPosition, currNode.move, g.positionHashes)
-		currNode.treeEvaluation = eval
-		return
+	// the transposition table doesn't cut the principal variation short
+	isPVNode := upperBoundEval-lowerBoundEval > nullWindow
+	isWhite := currPosition.whiteTurn
+	if ply > 0 {
+		var done bool
+		if lowerBoundEval, upperBoundEval, done = mateDistanceBounds(lowerBoundEval, upperBoundEval, isWhite, ply); done {
+			if isWhite {
+				return lowerBoundEval
+			}
+			return upperBoundEval
+		}
 	}
 
-	nodes, positions := generateNextMovePositions(currPosition, currNode)
-	if len(nodes) == 0 {
-		if currNode.move != nil {
-			eval := currPosition.Evaluate(currPosition, currNode.move, g.positionHashes)
-			currNode.treeEvaluation = eval
+	entry, found := transpositionTable.probe(currPosition.hash)
+	if found && ply > 0 && !isPVNode {
+		if eval, ok := entry.cutoff(depth, ply, lowerBoundEval, upperBoundEval); ok {
+			return eval
 		}
-		return
 	}
+	lowerBoundOrig, upperBoundOrig := lowerBoundEval, upperBoundEval
 
-	//Node evaluation is the evaluation of its best child (max for white and min for black)
-	//dfs
-	for i, childNode := range nodes {
-		move := childNode.move
+	inCheck := isKingAttacked(currPosition, isWhite)
+	moves := currPosition.GetAllMoves()
+	if len(moves) == 0 {
+		if inCheck {
+			return getCheckmateEvaluationAt(isWhite, ply)
+		}
+		return currPosition.evaluateMoves(moves, &g.noise)
+	}
 
-		childPosition := &positions[i]
+	alpha, beta := sideBounds(lowerBoundEval, upperBoundEval, isWhite)
+	isFutile := false
+	if !isPVNode && !inCheck && ply > 0 {
+		staticEval := currPosition.evaluateMoves(moves, &g.noise)
 
-		childPosition.hash = UpdateZobristHash(currPosition.hash, move, currPosition)
-		if isThreeFoldRepetition(childPosition, g.positionHashes) {
-			childNode.treeEvaluation = ColorFactor(move.isWhite) * ThreeFoldRepetitionEvalution
-		} else {
-			g.MinimaxTree(childNode, childPosition, depth-1, lowerBoundEval, upperBoundEval)
+		// reverse futility: the position is so good that the opponent won't allow it
+		if FutilityPruning && depth <= maxFutilityDepth && sideEval(staticEval, isWhite)-futilityMargin*Score(depth) >= beta {
+			return staticEval
 		}
 
-		if Debug {
-			evalStr := fmt.Sprintf("%.2f", childNode.treeEvaluation)
-			log.Println("MinimaxTree: Move: ", ToStringWithParents(childNode), ", eval: ", evalStr, ", alpha: ", fmt.Sprintf("%.2f", lowerBoundEval), ", beta: ", fmt.Sprintf("%.2f", upperBoundEval))
+		// null move: if passing the turn keeps the position above beta, a real move will too
+		if sideEval(staticEval, isWhite) >= beta && canTryNullMove(currPosition, depth, inCheck) {
+			if eval, ok := g.nullMoveSearch(currPosition, depth, lowerBoundEval, upperBoundEval); ok {
+				return eval
+			}
 		}
 
-		currNode.children = append(currNode.children, childNode)
-		eval := childNode.treeEvaluation
-		parentEval := currNode.treeEvaluation
+		// futility: near the leaves, quiet moves can't bring a position far below alpha back
+		isFutile = FutilityPruning && depth <= maxFutilityDepth && sideEval(staticEval, isWhite)+futilityMargin*Score(depth) <= alpha
+	}
 
-		if move.isWhite && eval >= parentEval {
-			currNode.bestChild = childNode
-			currNode.treeEvaluation = eval
-			//todo make it more efficient
-			//updateParentEvaluations(currNode)
+	currPosition.availableMoves = moves
+	var hashMove *Move
+	if found && entry.hasMove() {
+		hashMove = &entry.move
+	}
+	g.ordering.orderMoves(currPosition, moves, hashMove, ply)
 
-			if eval > lowerBoundEval {
-				lowerBoundEval = eval
-			}
-			if eval >= upperBoundEval {
-				break
+	bestEval := GetWorstEvaluation(isWhite)
+	var bestMove *Move
+	for i := range moves {
+		move := &moves[i]
+		isQuiet := !move.isCapture && move.pawnPromotePiece == 0
+
+		if ply == 0 {
+			if g.skipRootMove(move) {
+				continue
 			}
+			g.sendCurrMove(move, i+1)
+		}
+		g.pv.clear(ply + 1)
+		currPosition.MakeMove(move)
+		givesCheck := isKingAttacked(currPosition, currPosition.whiteTurn)
+		if isFutile && bestMove != nil && isQuiet && !givesCheck {
+			currPosition.UnmakeMove()
+			continue
 		}
 
-		if !move.isWhite && eval <= parentEval {
-			currNode.bestChild = childNode
-			currNode.treeEvaluation = eval
-			//todo make it more efficient
-			//updateParentEvaluations(currNode)
+		// checks are searched a ply deeper, so the horizon doesn't hide what they lead to
+		newDepth := depth - 1
+		if givesCheck && ply < maxSearchDepth {
+			newDepth++
+		}
 
-			if eval < upperBoundEval {
-				upperBoundEval = eval
+		g.history.push(currPosition.hash)
+		var eval Score
+		if g.history.isSearchDraw(currPosition.halfmoveClock) {
+			eval = DrawEvaluation
+		} else if currPosition.IsFiftyMoveDraw() || currPosition.IsInsufficientMaterial() {
+			eval = 0
+		} else if bestMove == nil {
+			eval = g.MinimaxTree(currPosition, newDepth, lowerBoundEval, upperBoundEval)
+		} else {
+			reduction := 0
+			if LateMoveReductions && depth >= lmrMinDepth && i >= lmrMinMoves && isQuiet && !inCheck && !givesCheck && !g.ordering.isKiller(move, ply) {
+				reduction = g.ordering.lateMoveReduction(move, i, depth)
+			}
+
+			eval = g.nullWindowSearch(currPosition, newDepth-reduction, lowerBoundEval, upperBoundEval, isWhite)
+			if reduction > 0 && sideEval(eval, isWhite) > alpha && !g.timer.stopped {
+				eval = g.nullWindowSearch(currPosition, newDepth, lowerBoundEval, upperBoundEval, isWhite)
 			}
-			if eval <= lowerBoundEval {
-				break
+			if eval > lowerBoundEval && eval < upperBoundEval && !g.timer.stopped {
+				eval = g.MinimaxTree(currPosition, newDepth, lowerBoundEval, upperBoundEval)
+			}
+		}
+		g.history.pop()
+		currPosition.UnmakeMove()
+		if g.timer.stopped {
+			if ply == 0 && bestMove != nil {
+				return bestEval
 			}
+			return 0
 		}
 
-	}
-	currNode.treeNodesCount = len(nodes)
+		if g.debug {
+			log.Println("MinimaxTree: Move: ", move.String(), ", eval: ", eval, ", alpha: ", lowerBoundEval, ", beta: ", upperBoundEval)
+		}
 
-	//todo fix or remove to support pruning
-	UpdateParentValue(currNode, func(node *Node) {
-		s := 0
-		for _, c := range node.children {
-			s += c.treeNodesCount
+		if bestMove == nil || isWhite && eval > bestEval || !isWhite && eval < bestEval {
+			bestEval = eval
+			bestMove = move
+			g.pv.update(ply, move)
 		}
-		node.treeNodesCount = s
-	})
+		if ply == 0 {
+			g.timer.rootScored = true
+		}
+		if isWhite {
+			lowerBoundEval = max(lowerBoundEval, eval)
+		} else {
+			upperBoundEval = min(upperBoundEval, eval)
+		}
+		alpha, beta = sideBounds(lowerBoundEval, upperBoundEval, isWhite)
+		if alpha >= beta {
+			g.ordering.cutoff(move, depth, ply)
+			break
+		}
+	}
+
+	// the root is only stored when no moves are left out of its search
+	if ply > 0 || len(g.rootExcluded) == 0 && len(g.limits.SearchMoves) == 0 {
+		transpositionTable.store(currPosition.hash, depth, scoreBound(bestEval, lowerBoundOrig, upperBoundOrig), toTTScore(bestEval, ply), bestMove)
+	}
+	return bestEval
+}
+
+// skipRootMove tells if the search leaves a root move out: it isn't one of the searchmoves of the go command,
+// or MultiPV already found its line
+func (g *Game) skipRootMove(move *Move) bool {
+	isMove := func(m Move) bool { return isSameMove(&m, move) }
+	if len(g.limits.SearchMoves) > 0 && !slices.ContainsFunc(g.limits.SearchMoves, isMove) {
+		return true
+	}
+	return slices.ContainsFunc(g.rootExcluded, isMove)
+}
+
+// mateDistanceBounds narrows the window to the evaluations still possible ply plies from the root: the side to move
+// can at best mate on the next ply and at worst be checkmated right away. done tells that the window is empty,
+// as a shorter mate was already found.
+func mateDistanceBounds(lowerBoundEval, upperBoundEval Score, isWhite bool, ply int) (Score, Score, bool) {
+	// the evaluations of checkmating the side to move at the next ply, and of the side to move being checkmated now
+	best := getCheckmateEvaluationAt(!isWhite, ply+1)
+	worst := getCheckmateEvaluationAt(isWhite, ply)
+	if isWhite {
+		lowerBoundEval, upperBoundEval = max(lowerBoundEval, worst), min(upperBoundEval, best)
+	} else {
+		lowerBoundEval, upperBoundEval = max(lowerBoundEval, best), min(upperBoundEval, worst)
+	}
+	return lowerBoundEval, upperBoundEval, lowerBoundEval >= upperBoundEval
+}
+
+// nullWindowSearch tests whether the move just made by the side is better than its bound: above lowerBoundEval
+// for white, below upperBoundEval for black
+func (g *Game) nullWindowSearch(p *Position, depth int, lowerBoundEval, upperBoundEval Score, isWhite bool) Score {
+	if isWhite {
+		return g.MinimaxTree(p, depth, lowerBoundEval, lowerBoundEval+nullWindow)
+	}
+	return g.MinimaxTree(p, depth, upperBoundEval-nullWindow, upperBoundEval)
+}
 
+// nullMoveSearch lets the opponent move twice in a row with a reduced search, and tells if the side to move
+// still fails high. Mates found this way aren't proven, so the bound is returned instead.
+func (g *Game) nullMoveSearch(p *Position, depth int, lowerBoundEval, upperBoundEval Score) (Score, bool) {
+	isWhite := p.whiteTurn
+	p.MakeNullMove()
+	g.history.push(p.hash)
+	var eval Score
+	if isWhite {
+		eval = g.MinimaxTree(p, depth-1-nullMoveReduction(depth), upperBoundEval-nullWindow, upperBoundEval)
+	} else {
+		eval = g.MinimaxTree(p, depth-1-nullMoveReduction(depth), lowerBoundEval, lowerBoundEval+nullWindow)
+	}
+	g.history.pop()
+	p.UnmakeNullMove()
+	if g.timer.stopped {
+		return 0, false
+	}
+
+	_, beta := sideBounds(lowerBoundEval, upperBoundEval, isWhite)
+	if sideEval(eval, isWhite) < beta {
+		return 0, false
+	}
+	if IsCheckmateEvaluation(eval) {
+		return ColorFactor(isWhite) * beta, true
+	}
+	return eval, true
 }
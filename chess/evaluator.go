@@ -1,53 +1,56 @@
 package chess
 
 import (
-	"math"
 	"math/rand"
 )
 
-const HighestPositionScore = math.MaxFloat32
-const LowestPositionScore = -math.MaxFloat32
+// Score is an evaluation in centipawns, positive when white is better
+type Score int32
 
-const ThreeFoldRepetitionEvalution = -1.900128
+// PawnScore is the value of a pawn
+const PawnScore = Score(100)
 
-const AvailableMovesFactor = float32(0.01)
-const AttackingMovesFactor = float32(0.02)
+// HighestPositionScore and LowestPositionScore bound all the evaluations, they are the initial alpha-beta window
+const HighestPositionScore = Score(1000000)
+const LowestPositionScore = -HighestPositionScore
 
-var pieceCost = map[uint8]float32{
-	PawnBit:   1,
-	KnightBit: 3,
-	BishopBit: 3,
-	RookBit:   5,
-	QueenBit:  9,
-	KingBit:   0,
-}
+// CheckmateEvaluation is the evaluation of a checkmate for the winner. The search scores a mate ply plies
+// from the root as CheckmateEvaluation - ply, so shorter mates are preferred and the distance can be reported.
+const CheckmateEvaluation = Score(100000)
+
+// DrawEvaluation is the evaluation of a drawn position, repetitions included
+const DrawEvaluation = Score(0)
 
-var allPieceIndexes = map[uint8]uint8{
-	PawnBit:   1,
-	KnightBit: 2,
-	BishopBit: 3,
-	RookBit:   4,
-	QueenBit:  5,
+// AvailableMovesFactor and AttackingMovesFactor are the values of a move and of a capture, for the mobility
+const AvailableMovesFactor = Score(1)
+const AttackingMovesFactor = Score(2)
+
+var pieceCost = map[uint8]Score{
+	PawnBit:   PawnScore,
+	KnightBit: 3 * PawnScore,
+	BishopBit: 3 * PawnScore,
+	RookBit:   5 * PawnScore,
+	QueenBit:  9 * PawnScore,
 	KingBit:   0,
 }
 
-var pieceSquares = map[byte][8][8]float32{
+var pieceSquares = map[byte][8][8]Score{
 	PawnBit: {
 		{0, 0, 0, 0, 0, 0, 0, 0},
 		{0, 0, 0, 0, 0, 0, 0, 0},
 		{0, 0, 0, 0, 0, 0, 0, 0},
-		{-0.1, -0.1, 0, 0.15, 0.15, 0, -0.05, -0.05},
-		{0, 0, 0, 0.15, 0.15, 0, 0, 0},
-		{0.1, 0.1, 0.15, 0.15, 0.15, 0.15, 0.1, 0.1},
-		{0.2, 0.2, 0.3, 0.3, 0.3, 0.3, 0.2, 0.2},
+		{-10, -10, 0, 15, 15, 0, -5, -5},
+		{0, 0, 0, 15, 15, 0, 0, 0},
+		{10, 10, 15, 15, 15, 15, 10, 10},
+		{20, 20, 30, 30, 30, 30, 20, 20},
 		{0, 0, 0, 0, 0, 0, 0, 0},
 	},
 	KnightBit: {
-		{-0.05, -0.03, 0, 0, 0, 0, -0.03, -0.05},
-		{-0.05, 0, 0, 0, 0, 0, 0, -0.05},
-		{-0.03, 0, 0.1, 0.1, 0.1, 0.1, 0, -0.03},
-		{0, 0, 0, 0.13, 0.13, 0, 0, 0},
-		{0, 0, 0, 0.13, 0.13, 0, 0, 0},
+		{-5, -3, 0, 0, 0, 0, -3, -5},
+		{-5, 0, 0, 0, 0, 0, 0, -5},
+		{-3, 0, 10, 10, 10, 10, 0, -3},
+		{0, 0, 0, 13, 13, 0, 0, 0},
+		{0, 0, 0, 13, 13, 0, 0, 0},
 		{0, 0, 0, 0, 0, 0, 0, 0},
 		{0, 0, 0, 0, 0, 0, 0, 0},
 		{0, 0, 0, 0, 0, 0, 0, 0},
@@ -55,10 +58,10 @@ var pieceSquares = map[byte][8][8]float32{
 	BishopBit: {
 		{0, 0, 0, 0, 0, 0, 0, 0},
 		{0, 0, 0, 0, 0, 0, 0, 0},
-		{0, 0.05, 0.05, 0.05, 0.05, 0.05, 0.05, 0},
-		{0.05, 0.05, 0.05, 0.05, 0.05, 0.05, 0.05, 0.05},
-		{0, 0.05, 0.05, 0.05, 0.05, 0.05, 0.05, 0},
-		{0, 0.05, 0.05, 0.05, 0.05, 0.05, 0.05, 0},
+		{0, 5, 5, 5, 5, 5, 5, 0},
+		{5, 5, 5, 5, 5, 5, 5, 5},
+		{0, 5, 5, 5, 5, 5, 5, 0},
+		{0, 5, 5, 5, 5, 5, 5, 0},
 		{0, 0, 0, 0, 0, 0, 0, 0},
 		{0, 0, 0, 0, 0, 0, 0, 0},
 	},
@@ -73,7 +76,7 @@ var pieceSquares = map[byte][8][8]float32{
 		{0, 0, 0, 0, 0, 0, 0, 0},
 	},
 	QueenBit: {
-		{0, 0, 0, 0.05, 0, 0, 0, 0},
+		{0, 0, 0, 5, 0, 0, 0, 0},
 		{0, 0, 0, 0, 0, 0, 0, 0},
 		{0, 0, 0, 0, 0, 0, 0, 0},
 		{0, 0, 0, 0, 0, 0, 0, 0},
@@ -83,12 +86,12 @@ var pieceSquares = map[byte][8][8]float32{
 		{0, 0, 0, 0, 0, 0, 0, 0},
 	},
 	KingBit: {
-		{0, 0.5, 0.5, -0.5, 0, -0.5, 0.5, 0},
-		{0, 0, -0.5, -0.5, -0.5, -0.5, 0, 0},
-		{-0.5, -0.5, -0.5, -0.5, -0.5, -0.5, -0.5, -0.5},
-		{-0.5, -0.5, -0.5, -0.5, -0.5, -0.5, -0.5, -0.5},
-		{-0.5, -0.5, -0.5, -0.5, -0.5, -0.5, -0.5, -0.5},
-		{-0.5, -0.5, -0.5, -0.5, -0.5, -0.5, -0.5, -0.5},
+		{0, 50, 50, -50, 0, -50, 50, 0},
+		{0, 0, -50, -50, -50, -50, 0, 0},
+		{-50, -50, -50, -50, -50, -50, -50, -50},
+		{-50, -50, -50, -50, -50, -50, -50, -50},
+		{-50, -50, -50, -50, -50, -50, -50, -50},
+		{-50, -50, -50, -50, -50, -50, -50, -50},
 		{0, 0, 0, 0, 0, 0, 0, 0},
 		{0, 0, 0, 0, 0, 0, 0, 0},
 	},
@@ -104,16 +107,30 @@ func getAttackingMoves(possibleMoves []Move) int {
 	return cnt
 }
 
-func (p *Position) Evaluate(prevPos *Position, move *Move, positionHashes map[uint64]bool) float32 {
+// Evaluate scores the position for white. p.availableMoves holds the moves of the previous position,
+// which is the case in the search after MakeMove. Repetitions are detected by the search.
+func (p *Position) Evaluate() Score {
+	return p.evaluateMoves(p.GetAllMoves(), nil)
+}
 
-	p.hash = UpdateZobristHash(prevPos.hash, move, prevPos)
+// DefaultRandomness is the default of the Randomness option, the highest random value added to the evaluation
+const DefaultRandomness = Score(20)
 
-	if isThreeFoldRepetition(p, positionHashes) {
-		p.evaluation = ColorFactor(move.isWhite) * ThreeFoldRepetitionEvalution
-		return p.evaluation
+// evaluationNoise adds random values below max to the evaluations
+type evaluationNoise struct {
+	rand *rand.Rand
+	max  Score
+}
+
+func (n *evaluationNoise) value() Score {
+	if n == nil || n.rand == nil || n.max <= 0 {
+		return 0
 	}
+	return Score(n.rand.Intn(int(n.max)))
+}
 
-	possibleMoves := p.GetAllMoves()
+// evaluateMoves is Evaluate for the legal moves of the position, with a random value of the noise added
+func (p *Position) evaluateMoves(possibleMoves []Move, noise *evaluationNoise) Score {
 	possibleAttackingMoves := getAttackingMoves(possibleMoves)
 
 	if len(possibleMoves) == 0 {
@@ -128,28 +145,26 @@ func (p *Position) Evaluate(prevPos *Position, move *Move, positionHashes map[ui
 		}
 	}
 
+	if p.halfmoveClock >= 100 || p.IsInsufficientMaterial() {
+		p.evaluation = 0
+		return 0
+	}
+
 	eval := countMaterial(p)
 
-	eval += ColorFactor(p.whiteTurn) * AvailableMovesFactor * float32(len(possibleMoves)-len(prevPos.availableMoves))
-	eval += ColorFactor(p.whiteTurn) * AttackingMovesFactor * float32(possibleAttackingMoves-getAttackingMoves(prevPos.availableMoves))
+	eval += ColorFactor(p.whiteTurn) * AvailableMovesFactor * Score(len(possibleMoves)-len(p.availableMoves))
+	eval += ColorFactor(p.whiteTurn) * AttackingMovesFactor * Score(possibleAttackingMoves-getAttackingMoves(p.availableMoves))
 
 	//add a random value to evaluation to make the game less predictable, otherwise the same games keep occurring
-	eval += ColorFactor(p.whiteTurn) * rand.Float32() * 0.2
+	eval += ColorFactor(p.whiteTurn) * noise.value()
 
 	p.evaluation = eval
 
 	return eval
 }
 
-// checks whether the hash of the position already exists in position hashes
-func isThreeFoldRepetition(pos *Position, positionHashes map[uint64]bool) bool {
-	_, exists := positionHashes[pos.hash]
-
-	return exists
-}
-
-func countMaterial(p *Position) float32 {
-	res := float32(0.0)
+func countMaterial(p *Position) Score {
+	res := Score(0)
 	for i := uint8(0); i < 8; i++ {
 		for j := uint8(0); j < 8; j++ {
 			piece, isWhite := getPiece(i, j, p)
@@ -165,8 +180,8 @@ func countMaterial(p *Position) float32 {
 	return res
 }
 
-func ColorFactor(isWhite bool) float32 {
-	return float32(ColorFactorInt(isWhite))
+func ColorFactor(isWhite bool) Score {
+	return Score(ColorFactorInt(isWhite))
 }
 
 func ColorFactorInt(isWhite bool) int8 {
@@ -177,7 +192,7 @@ func ColorFactorInt(isWhite bool) int8 {
 	return int8(color)
 }
 
-func Abs(num float32) float32 {
+func Abs(num Score) Score {
 	if num >= 0 {
 		return num
 	} else {
@@ -185,10 +200,23 @@ func Abs(num float32) float32 {
 	}
 }
 
-func GetCheckmateEvaluation(whiteTurn bool) float32 {
-	return HighestPositionScore * ColorFactor(whiteTurn) * (-1)
+// GetCheckmateEvaluation is the evaluation of the position when the side to move is checkmated
+func GetCheckmateEvaluation(whiteTurn bool) Score {
+	return getCheckmateEvaluationAt(whiteTurn, 0)
+}
+
+// getCheckmateEvaluationAt is the evaluation when the side to move is checkmated ply plies from the root
+func getCheckmateEvaluationAt(whiteTurn bool, ply int) Score {
+	return (CheckmateEvaluation - Score(ply)) * ColorFactor(whiteTurn) * (-1)
+}
+
+// IsCheckmateEvaluation checks if the evaluation is a forced checkmate, for either side
+func IsCheckmateEvaluation(evaluation Score) bool {
+	abs := Abs(evaluation)
+	return abs >= CheckmateEvaluation-maxPly && abs <= CheckmateEvaluation
 }
 
-func IsCheckmateEvaluation(evaluation float32) bool {
-	return HighestPositionScore == math.Abs(float64(evaluation))
+// checkmatePlies returns the number of plies to the checkmate of a checkmate evaluation
+func checkmatePlies(evaluation Score) int {
+	return int(CheckmateEvaluation - Abs(evaluation))
 }
@@ -0,0 +1,256 @@
+package chess
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const StartFEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+// ParseFEN creates a position from a FEN string. The halfmove clock and the fullmove number may be omitted,
+// in which case they default to 0 and 1.
+func ParseFEN(fen string) (*Position, error) {
+	fields := strings.Fields(fen)
+	if len(fields) != 4 && len(fields) != 6 {
+		return nil, fmt.Errorf("FEN must have 4 or 6 fields, got %d: %q", len(fields), fen)
+	}
+
+	p := &Position{
+		moveNum:                1,
+		whitePawnDoubleStepCol: noDoubleStep,
+		blackPawnDoubleStepCol: noDoubleStep,
+	}
+
+	if err := p.parseFENBoard(fields[0]); err != nil {
+		return nil, err
+	}
+
+	switch fields[1] {
+	case "w":
+		p.whiteTurn = true
+	case "b":
+		p.whiteTurn = false
+	default:
+		return nil, fmt.Errorf("invalid active color %q", fields[1])
+	}
+
+	if err := p.parseFENCastling(fields[2]); err != nil {
+		return nil, err
+	}
+
+	if err := p.parseFENEnPassant(fields[3]); err != nil {
+		return nil, err
+	}
+
+	if len(fields) == 6 {
+		halfmoveClock, err := strconv.Atoi(fields[4])
+		if err != nil || halfmoveClock < 0 {
+			return nil, fmt.Errorf("invalid halfmove clock %q", fields[4])
+		}
+		fullmoveNumber, err := strconv.Atoi(fields[5])
+		if err != nil || fullmoveNumber < 1 {
+			return nil, fmt.Errorf("invalid fullmove number %q", fields[5])
+		}
+		p.halfmoveClock = halfmoveClock
+		p.moveNum = fullmoveNumber
+	}
+
+	// the side to move could capture the king
+	if isKingAttacked(p, !p.whiteTurn) {
+		return nil, fmt.Errorf("the side not to move is in check: %q", fen)
+	}
+	return p, nil
+}
+
+func (p *Position) parseFENBoard(board string) error {
+	ranks := strings.Split(board, "/")
+	if len(ranks) != 8 {
+		return fmt.Errorf("FEN board must have 8 ranks, got %d: %q", len(ranks), board)
+	}
+
+	for i, rank := range ranks {
+		row := uint8(7 - i)
+		col := uint8(0)
+		for _, char := range rank {
+			if char >= '1' && char <= '8' {
+				col += uint8(char - '0')
+				continue
+			}
+
+			piece := PieceStrToPieceBit(string(char))
+			if piece == 0 {
+				return fmt.Errorf("invalid piece %q in FEN rank %q", char, rank)
+			}
+			if col > 7 {
+				return fmt.Errorf("FEN rank %q is longer than 8 squares", rank)
+			}
+			if piece == PawnBit && (row == 0 || row == 7) {
+				return fmt.Errorf("pawn on the first or the last rank in FEN rank %q", rank)
+			}
+			p.putPiece(squareIndex(row, col), piece, unicode.IsUpper(char))
+			col++
+		}
+		if col != 8 {
+			return fmt.Errorf("FEN rank %q must have 8 squares", rank)
+		}
+	}
+
+	for _, isWhite := range []bool{true, false} {
+		kings := p.piecesOf(KingBit, isWhite)
+		if bits.OnesCount64(kings) != 1 {
+			return fmt.Errorf("FEN board must have exactly one king of each color: %q", board)
+		}
+		sq := uint8(bits.TrailingZeros64(kings))
+		if isWhite {
+			p.whiteKingPosRow, p.whiteKingPosCol = sq/8, sq%8
+		} else {
+			p.blackKingPosRow, p.blackKingPosCol = sq/8, sq%8
+		}
+	}
+	return nil
+}
+
+func (p *Position) parseFENCastling(castling string) error {
+	if castling == "-" {
+		return nil
+	}
+	for _, char := range castling {
+		switch char {
+		case 'K':
+			p.whiteShortCastleAllowed = true
+		case 'Q':
+			p.whiteLongCastleAllowed = true
+		case 'k':
+			p.blackShortCastleAllowed = true
+		case 'q':
+			p.blackLongCastleAllowed = true
+		default:
+			return fmt.Errorf("invalid castling rights %q", castling)
+		}
+	}
+
+	// a right is dropped when its king or rook isn't on its initial square, as no move could ever use it
+	hasPiece := func(row, col uint8, piece uint8, isWhite bool) bool {
+		pieceBit, white := getPiece(row, col, p)
+		return pieceBit == piece && white == isWhite
+	}
+	whiteKing, blackKing := hasPiece(0, 4, KingBit, true), hasPiece(7, 4, KingBit, false)
+	p.whiteShortCastleAllowed = p.whiteShortCastleAllowed && whiteKing && hasPiece(0, 7, RookBit, true)
+	p.whiteLongCastleAllowed = p.whiteLongCastleAllowed && whiteKing && hasPiece(0, 0, RookBit, true)
+	p.blackShortCastleAllowed = p.blackShortCastleAllowed && blackKing && hasPiece(7, 7, RookBit, false)
+	p.blackLongCastleAllowed = p.blackLongCastleAllowed && blackKing && hasPiece(7, 0, RookBit, false)
+	return nil
+}
+
+func (p *Position) parseFENEnPassant(square string) error {
+	if square == "-" {
+		return nil
+	}
+	row, col, err := parseSquare(square)
+	if err != nil {
+		return err
+	}
+
+	// the square is empty and behind the pawn that just made a double step
+	pawnRow := row + 1
+	if p.whiteTurn {
+		pawnRow = row - 1
+	}
+	piece, isWhite := getPiece(pawnRow, col, p)
+	if p.whiteTurn && row != 5 || !p.whiteTurn && row != 2 || piece != PawnBit || isWhite == p.whiteTurn || !isVacantSquare(p, row, col) {
+		return fmt.Errorf("invalid en passant square %q", square)
+	}
+
+	if p.whiteTurn {
+		p.blackPawnDoubleStepCol = col
+	} else {
+		p.whitePawnDoubleStepCol = col
+	}
+	return nil
+}
+
+func parseSquare(square string) (uint8, uint8, error) {
+	if len(square) != 2 || square[0] < 'a' || square[0] > 'h' || square[1] < '1' || square[1] > '8' {
+		return 0, 0, fmt.Errorf("invalid square %q", square)
+	}
+	return square[1] - '1', square[0] - 'a', nil
+}
+
+func squareToString(row, col uint8) string {
+	return fmt.Sprintf("%s%d", string(rune('a'+col)), row+1)
+}
+
+// FEN converts the position to a FEN string
+func (p *Position) FEN() string {
+	var sb strings.Builder
+
+	// Board layout
+	for row := 7; row >= 0; row-- {
+		emptyCount := 0
+		for col := 0; col < 8; col++ {
+			piece, isWhite := getPiece(uint8(row), uint8(col), p)
+			if piece == 0 {
+				emptyCount++
+			} else {
+				if emptyCount > 0 {
+					sb.WriteString(fmt.Sprintf("%d", emptyCount))
+					emptyCount = 0
+				}
+				pieceStr := PieceToString(piece)
+				if isWhite {
+					pieceStr = strings.ToUpper(pieceStr)
+				}
+				sb.WriteString(pieceStr)
+			}
+		}
+		if emptyCount > 0 {
+			sb.WriteString(fmt.Sprintf("%d", emptyCount))
+		}
+		if row > 0 {
+			sb.WriteString("/")
+		}
+	}
+
+	// Active color
+	if p.whiteTurn {
+		sb.WriteString(" w ")
+	} else {
+		sb.WriteString(" b ")
+	}
+
+	// Castling availability
+	castling := ""
+	if p.whiteShortCastleAllowed {
+		castling += "K"
+	}
+	if p.whiteLongCastleAllowed {
+		castling += "Q"
+	}
+	if p.blackShortCastleAllowed {
+		castling += "k"
+	}
+	if p.blackLongCastleAllowed {
+		castling += "q"
+	}
+	if castling == "" {
+		castling = "-"
+	}
+	sb.WriteString(castling + " ")
+
+	// En passant target square, the square the last pawn double step passed over
+	if p.whiteTurn && p.blackPawnDoubleStepCol != noDoubleStep {
+		sb.WriteString(squareToString(5, p.blackPawnDoubleStepCol) + " ")
+	} else if !p.whiteTurn && p.whitePawnDoubleStepCol != noDoubleStep {
+		sb.WriteString(squareToString(2, p.whitePawnDoubleStepCol) + " ")
+	} else {
+		sb.WriteString("- ")
+	}
+
+	// Halfmove clock and fullmove number
+	sb.WriteString(fmt.Sprintf("%d %d", p.halfmoveClock, p.moveNum))
+
+	return sb.String()
+}
@@ -0,0 +1,102 @@
+package chess
+
+import (
+	"testing"
+)
+
+// mustParseFEN parses a FEN of a test, which fails on an invalid one
+func mustParseFEN(t *testing.T, fen string) *Position {
+	p, err := ParseFEN(fen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestFENRoundTrip(t *testing.T) {
+	fens := []string{
+		StartFEN,
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+		"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 b - - 37 112",
+	}
+	for _, fen := range fens {
+		p, err := ParseFEN(fen)
+		if err != nil {
+			t.Errorf("ParseFEN(%q) failed: %v", fen, err)
+			continue
+		}
+		if p.FEN() != fen {
+			t.Errorf("FEN round trip failed: got %q, expected %q", p.FEN(), fen)
+		}
+	}
+}
+
+func TestFENAfterMoves(t *testing.T) {
+	e, _ := newTestEngine()
+	e.HandleCommand("ucinewgame")
+	e.HandleCommand("position startpos moves e2e4 d7d5 e4d5 e7e5 d5e6 e8e7 d2d4")
+
+	expected := "rnbq1bnr/ppp1kppp/4P3/8/3P4/8/PPP2PPP/RNBQKBNR b KQ d3 0 4"
+	if fen := e.game.position.FEN(); fen != expected {
+		t.Errorf("Got FEN %q, expected %q", fen, expected)
+	}
+}
+
+func TestFENDropsImpossibleCastling(t *testing.T) {
+	tests := map[string]string{
+		"4k3/8/8/8/8/8/8/R3K2R w KQkq - 0 1":     "4k3/8/8/8/8/8/8/R3K2R w KQ - 0 1",
+		"r3k2r/8/8/8/8/8/8/R4K1R w KQkq - 0 1":   "r3k2r/8/8/8/8/8/8/R4K1R w kq - 0 1",
+		"1r2k2r/8/8/8/8/8/8/R3K1R1 b KQkq - 0 1": "1r2k2r/8/8/8/8/8/8/R3K1R1 b Qk - 0 1",
+		"r3k2r/8/8/8/8/8/8/r3K2R w KQkq - 0 1":   "r3k2r/8/8/8/8/8/8/r3K2R w Kkq - 0 1",
+	}
+	for fen, expected := range tests {
+		p, err := ParseFEN(fen)
+		if err != nil {
+			t.Fatalf("ParseFEN(%q) failed: %v", fen, err)
+		}
+		if p.FEN() != expected {
+			t.Errorf("expected %q, got %q", expected, p.FEN())
+		}
+	}
+}
+
+func TestParseFENErrors(t *testing.T) {
+	fens := []string{
+		"",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP w KQkq - 0 1",
+		"rnbqkbnr/pppppppp/9/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNRR w KQkq - 0 1",
+		"rnbqkbnr/ppppxppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"rnbq1bnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR x KQkq - 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQxq - 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq e9 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq e3 0 1",
+		// no white pawn made the double step to d4
+		"4k3/8/8/8/4p3/8/8/4K3 b - d3 0 1",
+		// white to move could capture the black king
+		"4k3/8/8/8/8/8/8/4R1K1 w - - 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - x 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 0",
+	}
+	for _, fen := range fens {
+		if _, err := ParseFEN(fen); err == nil {
+			t.Errorf("ParseFEN(%q) should have failed", fen)
+		}
+	}
+}
+
+func TestHalfmoveClock(t *testing.T) {
+	e, _ := newTestEngine()
+	e.HandleCommand("ucinewgame")
+	e.HandleCommand("position startpos moves g1f3 g8f6 f3g1 f6g8 e2e4 g8f6")
+
+	expected := "rnbqkb1r/pppppppp/5n2/8/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 1 4"
+	if fen := e.game.position.FEN(); fen != expected {
+		t.Errorf("Got FEN %q, expected %q", fen, expected)
+	}
+}
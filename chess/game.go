@@ -1,6 +1,7 @@
 package chess
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"math/rand"
@@ -11,10 +12,12 @@ var TreeDepth = 2
 
 const Moves = 20
 
-// RandomSeed 0 = random
-var Debug = false
+// RandomSeed seeds the randomness of the evaluation of new games, 0 = random
 var RandomSeed = 0
 
+// HashSizeMB is the size of the transposition table
+var HashSizeMB = DefaultHashSizeMB
+
 type Game struct {
 	initPosition     *Position
 	position         *Position
@@ -26,8 +29,34 @@ type Game struct {
 
 	treeDepth int
 
+	// limits are the limits of the go command for the next search, see MakeMove, ponderhit is closed
+	// once a ponder search may use its time
+	limits    SearchLimits
+	ponderhit chan struct{}
+	timer     timeManager
+	ordering  moveOrdering
+	pv        pvTable
+	// selDepth is the highest ply the current iteration reached, quiescence included
+	selDepth int
+
+	// threads is the number of goroutines MakeMove searches with, threadID is 0 for the game itself
+	// and numbers the helpers of its search, see smp.go
+	threads  int
+	threadID int
+	// multiPV is the number of principal variations the main thread searches and reports, the root moves
+	// of the lines found in the current iteration are in rootExcluded
+	multiPV      int
+	rootExcluded []Move
+	// seed and noise make the evaluation of every thread a little different, see evaluateMoves
+	seed  int64
+	noise evaluationNoise
+
+	// output receives the info lines of the search, debug prints the principal variations too
+	output *uciOutput
+	debug  bool
+
 	// used for 3-fold repetition
-	positionHashes map[uint64]bool
+	history repetitionHistory
 }
 
 var g GameOperations = &Game{}
@@ -38,24 +67,35 @@ type GameOperations interface {
 }
 
 func (g *Game) InitGame(board *[8][8]string, moveWhite bool, treeDepth int) {
-	Init()
-
 	var positionStam PositionOperations = &Position{}
 	position := positionStam.InitPosition(board, 1, moveWhite)
+	g.InitGameFromPosition(position, treeDepth)
+}
+
+// InitGameFromPosition starts the game from any position, e.g. one created by ParseFEN
+func (g *Game) InitGameFromPosition(position *Position, treeDepth int) {
+	Init()
+
+	g.seed = int64(RandomSeed)
+	if RandomSeed == 0 {
+		g.seed = time.Now().UnixNano()
+	}
+	g.noise = evaluationNoise{rand: rand.New(rand.NewSource(g.seed)), max: DefaultRandomness}
+	log.Println("Random seed: ", g.seed)
+
+	position.hash = ComputeZobristHash(position)
 	g.initPosition = position
 	g.position = position
+	g.moves = nil
 	g.treeDepth = treeDepth
-	g.positionHashes = make(map[uint64]bool)
+	g.history.reset(position.hash)
 }
 
 func Init() {
-	s := int64(RandomSeed)
-	if RandomSeed == 0 {
-		s = time.Now().UnixNano()
-	}
-	rand.Seed(s)
-	log.Println("Random seed: ", s)
 	InitZobrist()
+	if transpositionTable == nil {
+		transpositionTable = NewTranspositionTable(HashSizeMB)
+	}
 }
 
 func (g *Game) GetLastMove() *Move {
@@ -66,26 +106,64 @@ func (g *Game) GetLastMove() *Move {
 }
 
 func (g *Game) MakeMove() {
-	moveSequence, eval := MakeMove(g.treeDepth, g)
-	if IsCheckmateEvaluation(eval) {
-		g.isFinished = true
-		g.result = 1 * int(ColorFactor(g.position.whiteTurn))
-	}
+	g.MakeMoveContext(context.Background())
+}
 
-	if moveSequence != nil && len(moveSequence) > 0 {
-		newPosition := ApplyMove(*g.position, moveSequence[0])
-		g.moves = append(g.moves, *moveSequence[0])
-		g.position = newPosition
+// MakeMoveContext is MakeMove that plays the best move found so far once ctx is done
+func (g *Game) MakeMoveContext(ctx context.Context) {
+	moveSequence, eval := MakeMoveContext(ctx, g.treeDepth, g)
+	if len(moveSequence) > 0 {
+		g.playMove(moveSequence[0])
 		g.position.evaluation = eval
 		g.bestMoveSequence = moveSequence
-	} else if !g.isFinished {
+	}
+
+	g.checkGameEnd()
+}
+
+// MakeBookMove plays a move of the book, if the position is in it
+func (g *Game) MakeBookMove(book *Book) bool {
+	move, ok := book.PickMove(g.position)
+	if !ok {
+		return false
+	}
+	g.playMove(&move)
+	g.bestMoveSequence = []*Move{&move}
+	g.checkGameEnd()
+	return true
+}
+
+func (g *Game) playMove(move *Move) {
+	newPosition := ApplyMove(*g.position, move)
+	newPosition.hash = ComputeZobristHash(newPosition)
+	g.moves = append(g.moves, *move)
+	g.position = newPosition
+	g.history.push(g.position.hash)
+}
+
+// checkGameEnd finishes the game when the side to move has no moves, the result is 1 when white wins,
+// -1 when black wins and 0 on a draw
+func (g *Game) checkGameEnd() {
+	if g.isFinished {
+		return
+	}
+	if len(g.position.GetAllMoves()) == 0 {
 		g.isFinished = true
 		g.result = 0
+		if isKingAttacked(g.position, g.position.whiteTurn) {
+			g.result = -int(ColorFactor(g.position.whiteTurn))
+		}
+		return
 	}
+	if g.IsThreeFoldRepetition() || g.position.IsFiftyMoveDraw() || g.position.IsInsufficientMaterial() {
+		g.isFinished = true
+		g.result = 0
+	}
+}
 
-	hash := g.position.hash
-	g.positionHashes[hash] = true
-
+// IsThreeFoldRepetition checks whether the current position occurred for the third time in the game
+func (g *Game) IsThreeFoldRepetition() bool {
+	return g.history.isThreeFoldRepetition(g.position.halfmoveClock)
 }
 
 func StartGame() {
@@ -0,0 +1,201 @@
+package chess
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+var rookDirections = [][2]int8{{1, 0}, {0, 1}, {-1, 0}, {0, -1}}
+var bishopDirections = [][2]int8{{1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+
+// magic maps every relevant occupancy of a square to a slot in its attacks table:
+// attacks[((occupied & mask) * magic) >> shift]
+type magic struct {
+	mask    uint64
+	magic   uint64
+	shift   uint8
+	attacks []uint64
+}
+
+var rookMagics [64]magic
+var bishopMagics [64]magic
+
+// rookMagicNumbers and bishopMagicNumbers were found by GenerateMagics(728)
+var rookMagicNumbers = [64]uint64{
+	0x0a80004000801220, 0x10c0100040002000, 0x0100102000410009, 0x0b0021000c100008,
+	0x4080080080040002, 0x0200019004080200, 0x0400080a10112684, 0x20800a4d00062080,
+	0x2091800020804000, 0x0044401000200040, 0x1001002000401108, 0x1001800801100081,
+	0x0001000500080010, 0x1000808002000400, 0x0404000482100108, 0x0003000182610002,
+	0x0440848002c00420, 0x2010890040010021, 0x8800110020044300, 0x0208010100201000,
+	0x1222020004102008, 0x0000808002000400, 0x8200940041820810, 0x0000420000804401,
+	0x0040002880004680, 0x0000200240100040, 0x0020008180201001, 0x01080080800c1000,
+	0x2108080080040080, 0x2861004900020400, 0x8423040101000200, 0x0180904a00010884,
+	0x10c0018845800070, 0x0030802008804004, 0x0020802000801008, 0x0020100842002200,
+	0x0400110005000800, 0x0802010402000810, 0x14a0800200800100, 0x0441801060800100,
+	0x4404708140008001, 0x0000500120014000, 0x0000200300430010, 0x0318091001030020,
+	0x0000040008008080, 0x0000040002008080, 0x010018210a0c0090, 0x90000900408a000c,
+	0x0408cc2380010100, 0x1004804000211300, 0x0004200100481100, 0x0000100008008080,
+	0x2014050010080100, 0x0102020004008080, 0x8010421021080400, 0x1006004084110200,
+	0x0000108001042043, 0x0800608901144001, 0x2400081100402001, 0x00a0040820100101,
+	0x0022000820041002, 0x0a61000400080201, 0x1040083002008104, 0x4040054084002b02,
+}
+
+var bishopMagicNumbers = [64]uint64{
+	0x0004182088049100, 0x000808084e4040e1, 0x0108084040820440, 0x0004104202002100,
+	0x0082021000000148, 0x0801010840100801, 0x1004022210048000, 0x0109040901011040,
+	0x0002c08428420040, 0x0200020444040440, 0x0001080204002c48, 0x2200020a0a000000,
+	0x00040404200a9000, 0x0811088210420050, 0x0104840901292060, 0x0000a04404240282,
+	0x000800a460248424, 0x8805000204080201, 0x0082000408220202, 0x0808020082810030,
+	0x4062000c12020400, 0x0082000840422001, 0x004054141c040423, 0x208220020a011480,
+	0x002060100843040a, 0x000420500202040a, 0x8092010040810200, 0x4c24080104012002,
+	0x0511001081004000, 0x0000404106011010, 0x2a18106a46010401, 0x180048800904a800,
+	0x1024200441610402, 0x0204046026044104, 0x1480209010080022, 0x0849040108240100,
+	0x0140008020020021, 0x0029015600210104, 0x0090220086460880, 0x81143080800a0840,
+	0x4008080886020800, 0x0010820120405000, 0x2210082804090804, 0x4000102011012800,
+	0x400002120a000404, 0x0804008802024910, 0x94101000c5000087, 0x0010041104280842,
+	0x80020114a00484c0, 0x00208401211102b0, 0x0010014618240002, 0x0010000220881000,
+	0x00a0044050248000, 0x2220102001011280, 0x0040842800c11000, 0x642001011a008013,
+	0x0001040201040290, 0x4002504044300800, 0x0080110042080411, 0x0002000000840400,
+	0x414a02b020042402, 0x40090b2002421202, 0x0288903090010047, 0x1003204104008180,
+}
+
+func init() {
+	for sq := uint8(0); sq < 64; sq++ {
+		rookMagics[sq] = newMagic(sq, rookDirections, rookMagicNumbers[sq])
+		bishopMagics[sq] = newMagic(sq, bishopDirections, bishopMagicNumbers[sq])
+	}
+}
+
+func bishopAttacks(sq uint8, occupied uint64) uint64 {
+	m := &bishopMagics[sq]
+	return m.attacks[((occupied&m.mask)*m.magic)>>m.shift]
+}
+
+func rookAttacks(sq uint8, occupied uint64) uint64 {
+	m := &rookMagics[sq]
+	return m.attacks[((occupied&m.mask)*m.magic)>>m.shift]
+}
+
+// slidingAttacks walks the rays from the square one step at a time, up to and including the first blocker
+func slidingAttacks(sq uint8, occupied uint64, directions [][2]int8) uint64 {
+	res := uint64(0)
+	for _, dir := range directions {
+		for r, c := int8(sq/8)+dir[0], int8(sq%8)+dir[1]; isInsideBoard(r, c); r, c = r+dir[0], c+dir[1] {
+			bit := squareBit(uint8(r), uint8(c))
+			res |= bit
+			if occupied&bit != 0 {
+				break
+			}
+		}
+	}
+	return res
+}
+
+// relevantOccupancyMask returns the squares whose occupancy changes the attacks from the square.
+// The last square of every ray is attacked whether it is occupied or not, so it is left out.
+func relevantOccupancyMask(sq uint8, directions [][2]int8) uint64 {
+	res := uint64(0)
+	for _, dir := range directions {
+		for r, c := int8(sq/8)+dir[0], int8(sq%8)+dir[1]; isInsideBoard(r+dir[0], c+dir[1]); r, c = r+dir[0], c+dir[1] {
+			res |= squareBit(uint8(r), uint8(c))
+		}
+	}
+	return res
+}
+
+// newMagic fills the attacks table of the square for a known magic number
+func newMagic(sq uint8, directions [][2]int8, magicNumber uint64) magic {
+	mask := relevantOccupancyMask(sq, directions)
+	relevantBits := bits.OnesCount64(mask)
+	m := magic{
+		mask:    mask,
+		magic:   magicNumber,
+		shift:   uint8(64 - relevantBits),
+		attacks: make([]uint64, 1<<relevantBits),
+	}
+
+	filled := make([]bool, len(m.attacks))
+	for subset := uint64(0); ; {
+		attacks := slidingAttacks(sq, subset, directions)
+		index := (subset * m.magic) >> m.shift
+		if filled[index] && m.attacks[index] != attacks {
+			panic(fmt.Sprintf("invalid magic number %x for square %d", magicNumber, sq))
+		}
+		filled[index] = true
+		m.attacks[index] = attacks
+
+		subset = (subset - mask) & mask
+		if subset == 0 {
+			break
+		}
+	}
+	return m
+}
+
+// findMagic searches for a magic number that maps every occupancy of the mask to a slot without
+// destructive collisions, by trying sparse random numbers
+func findMagic(sq uint8, directions [][2]int8, rng *uint64) magic {
+	mask := relevantOccupancyMask(sq, directions)
+	relevantBits := bits.OnesCount64(mask)
+
+	// enumerate all the subsets of the mask (Carry-Rippler)
+	occupancies := make([]uint64, 0, 1<<relevantBits)
+	attacks := make([]uint64, 0, 1<<relevantBits)
+	for subset := uint64(0); ; {
+		occupancies = append(occupancies, subset)
+		attacks = append(attacks, slidingAttacks(sq, subset, directions))
+		subset = (subset - mask) & mask
+		if subset == 0 {
+			break
+		}
+	}
+
+	m := magic{
+		mask:    mask,
+		shift:   uint8(64 - relevantBits),
+		attacks: make([]uint64, 1<<relevantBits),
+	}
+	// usedInAttempt saves clearing the table on every attempt
+	usedInAttempt := make([]int, len(m.attacks))
+
+	for attempt := 1; attempt < 100000000; attempt++ {
+		m.magic = nextRandom(rng) & nextRandom(rng) & nextRandom(rng)
+		if bits.OnesCount64((mask*m.magic)>>56) < 6 {
+			continue
+		}
+
+		valid := true
+		for i, occupancy := range occupancies {
+			index := (occupancy * m.magic) >> m.shift
+			if usedInAttempt[index] != attempt {
+				usedInAttempt[index] = attempt
+				m.attacks[index] = attacks[i]
+			} else if m.attacks[index] != attacks[i] {
+				valid = false
+				break
+			}
+		}
+		if valid {
+			return m
+		}
+	}
+	panic(fmt.Sprintf("failed to find a magic number for square %d", sq))
+}
+
+// GenerateMagics finds magic numbers for all the squares, to replace the rookMagicNumbers and bishopMagicNumbers tables
+func GenerateMagics(seed uint64) (rook [64]uint64, bishop [64]uint64) {
+	rng := seed
+	for sq := uint8(0); sq < 64; sq++ {
+		rook[sq] = findMagic(sq, rookDirections, &rng).magic
+		bishop[sq] = findMagic(sq, bishopDirections, &rng).magic
+	}
+	return rook, bishop
+}
+
+// nextRandom is a xorshift64* generator, independent of the global rand state
+func nextRandom(state *uint64) uint64 {
+	*state ^= *state >> 12
+	*state ^= *state << 25
+	*state ^= *state >> 27
+	return *state * 2685821657736338717
+}
@@ -0,0 +1,37 @@
+package chess
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestMagicAttacksMatchRayWalk(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for sq := uint8(0); sq < 64; sq++ {
+		for i := 0; i < 1000; i++ {
+			// sparse occupancies are closer to real positions than uniformly random ones
+			occupied := r.Uint64() & r.Uint64()
+			if i%2 == 0 {
+				occupied &= r.Uint64()
+			}
+
+			if got, expected := rookAttacks(sq, occupied), slidingAttacks(sq, occupied, rookDirections); got != expected {
+				t.Fatalf("Rook attacks from %d with occupancy %x: got %x, expected %x", sq, occupied, got, expected)
+			}
+			if got, expected := bishopAttacks(sq, occupied), slidingAttacks(sq, occupied, bishopDirections); got != expected {
+				t.Fatalf("Bishop attacks from %d with occupancy %x: got %x, expected %x", sq, occupied, got, expected)
+			}
+		}
+	}
+}
+
+func TestFindMagic(t *testing.T) {
+	rng := uint64(1)
+	m := findMagic(0, rookDirections, &rng)
+	if m.shift != 64-12 {
+		t.Errorf("A rook in the corner has 12 relevant squares, got shift %d", m.shift)
+	}
+	if got := m.attacks[0]; got != slidingAttacks(0, 0, rookDirections) {
+		t.Errorf("Attacks on an empty board are wrong: %x", got)
+	}
+}
@@ -1,32 +1,17 @@
 package chess
 
-func (p *Position) appendMoveIfValid(fromRow, fromCol, toRow, toCol, pawnPromotePiece uint8, isWhite, isCapture, checkVacancy bool, moves []Move) []Move {
-	if isSquareOutsideTheBoard(toRow, toCol) {
-		return moves
-	}
-
-	piece, color := getPiece(toRow, toCol, p)
-	if !checkVacancy {
-		if piece != 0 {
-			isCapture = true
-		}
-		return append(moves, Move{fromRow, fromCol, toRow, toCol, isWhite, isCapture, pawnPromotePiece, false})
-	}
-
-	if piece != 0 && color == isWhite {
-		return moves
-	}
-
-	if piece != 0 && color != isWhite {
-		fromPiece, _ := getPiece(fromRow, fromCol, p)
-		if !isCapture && fromPiece == PawnBit {
-			return moves
-		}
+func newMove(from, to uint8, isWhite, isCapture bool, pawnPromotePiece uint8) Move {
+	return Move{from / 8, from % 8, to / 8, to % 8, isWhite, isCapture, pawnPromotePiece, false}
+}
 
-		isCapture = true
+// appendTargetMoves appends a move from the square to every square of the targets bitboard
+func (p *Position) appendTargetMoves(from uint8, targets uint64, isWhite bool, moves []Move) []Move {
+	enemies := p.colors[colorIndex(!isWhite)]
+	for targets != 0 {
+		to := popLSB(&targets)
+		moves = append(moves, newMove(from, to, isWhite, enemies&(uint64(1)<<to) != 0, 0))
 	}
-
-	return append(moves, Move{fromRow, fromCol, toRow, toCol, isWhite, isCapture, pawnPromotePiece, false})
+	return moves
 }
 
 func isSquareOutsideTheBoard(toRow uint8, toCol uint8) bool {
@@ -41,146 +26,124 @@ func getKingInitSquare(isWhite bool) (uint8, uint8) {
 	}
 }
 
+// squares between the king and the rook that must be vacant for castling, relative to the first row
+const shortCastleGap = uint64(0x60)
+const longCastleGap = uint64(0x0E)
+
 func (p *Position) addCastlingMoves(row, col uint8, isWhite bool, moves []Move) []Move {
 
 	kRow, kCol := getKingInitSquare(isWhite)
-	if row == kRow && kCol == col {
-		if isWhite {
-			piece, w := getPiece(0, 0, p)
-			if piece == RookBit && w == isWhite && p.board[0][1] == 0 && p.board[0][2] == 0 && p.board[0][3] == 0 && p.whiteLongCastleAllowed {
-				moves = p.appendMoveIfValid(row, col, row, 2, 0, isWhite, false, true, moves)
-			}
-			piece, w = getPiece(0, 7, p)
-			if piece == RookBit && w == isWhite && p.board[0][6] == 0 && p.board[0][5] == 0 && p.whiteShortCastleAllowed {
-				moves = p.appendMoveIfValid(row, col, row, 6, 0, isWhite, false, true, moves)
-			}
-
-		} else {
-			piece, w := getPiece(7, 0, p)
-			if piece == RookBit && w == isWhite && p.board[7][1] == 0 && p.board[7][2] == 0 && p.board[7][3] == 0 && p.blackLongCastleAllowed {
-				moves = p.appendMoveIfValid(row, col, row, 2, 0, isWhite, false, true, moves)
-			}
-			piece, w = getPiece(7, 7, p)
-			if piece == RookBit && w == isWhite && p.board[7][6] == 0 && p.board[7][5] == 0 && p.blackLongCastleAllowed {
-				moves = p.appendMoveIfValid(row, col, row, 6, 0, isWhite, false, true, moves)
-			}
+	if row != kRow || kCol != col {
+		return moves
+	}
 
-		}
+	shortAllowed, longAllowed := p.whiteShortCastleAllowed, p.whiteLongCastleAllowed
+	if !isWhite {
+		shortAllowed, longAllowed = p.blackShortCastleAllowed, p.blackLongCastleAllowed
+	}
+	rooks := p.piecesOf(RookBit, isWhite)
+	occupied := p.occupied()
+	shift := squareIndex(row, 0)
 
+	if longAllowed && rooks&squareBit(row, 0) != 0 && occupied&(longCastleGap<<shift) == 0 {
+		moves = append(moves, newMove(squareIndex(row, col), squareIndex(row, 2), isWhite, false, 0))
+	}
+	if shortAllowed && rooks&squareBit(row, 7) != 0 && occupied&(shortCastleGap<<shift) == 0 {
+		moves = append(moves, newMove(squareIndex(row, col), squareIndex(row, 6), isWhite, false, 0))
 	}
 	return moves
 }
 
 func (p *Position) GetPossibleMoves(row uint8, col uint8, isWhite bool) []Move {
-	var moves []Move
-
 	pieceBit, isWhitePiece := getPiece(row, col, p)
 	if pieceBit == 0 || isWhitePiece != isWhite {
 		return nil
 	}
 
-	if pieceBit == PawnBit {
-		if isWhite {
-			if row < 6 {
-				moves = p.appendMoveIfValid(row, col, row+1, col, 0, isWhite, false, true, moves)
-				moves = p.appendMoveIfValid(row, col, row+1, col+1, 0, isWhite, true, true, moves)
-				moves = p.appendMoveIfValid(row, col, row+1, col-1, 0, isWhite, true, true, moves)
-			} else {
-				// Handle promotion
-				for _, pieceToPromote := range piecesToPromote {
-					pieceWithWhite := createPiece(pieceToPromote, isWhite)
-					moves = p.appendMoveIfValid(row, col, row+1, col, pieceWithWhite, isWhite, false, true, moves)
-					moves = p.appendMoveIfValid(row, col, row+1, col+1, pieceWithWhite, isWhite, true, true, moves)
-					moves = p.appendMoveIfValid(row, col, row+1, col-1, pieceWithWhite, isWhite, true, true, moves)
-				}
-			}
-			if row == 1 {
-				moves = p.appendMoveIfValid(row, col, row+2, col, 0, isWhite, false, true, moves)
-			}
-		} else {
-			if row > 1 {
-				moves = p.appendMoveIfValid(row, col, row-1, col, 0, isWhite, false, true, moves)
-				moves = p.appendMoveIfValid(row, col, row-1, col-1, 0, isWhite, true, true, moves)
-				moves = p.appendMoveIfValid(row, col, row-1, col+1, 0, isWhite, true, true, moves)
-			} else {
-				for _, pieceToPromote := range piecesToPromote {
-					pieceWithWhite := createPiece(pieceToPromote, isWhite)
-					moves = p.appendMoveIfValid(row, col, row-1, col, pieceWithWhite, isWhite, false, true, moves)
-					moves = p.appendMoveIfValid(row, col, row-1, col-1, pieceWithWhite, isWhite, true, true, moves)
-					moves = p.appendMoveIfValid(row, col, row-1, col+1, pieceWithWhite, isWhite, true, true, moves)
-				}
-			}
-			if row == 6 {
-				moves = p.appendMoveIfValid(row, col, row-2, col, 0, isWhite, false, true, moves)
-			}
-		}
+	//printMoves(moves, "GetPossibleMoves")
+
+	return p.appendPieceMoves(squareIndex(row, col), isWhite, nil)
+}
 
+// appendPieceMoves appends the pseudo legal moves of the piece on the square, except en passant
+func (p *Position) appendPieceMoves(sq uint8, isWhite bool, moves []Move) []Move {
+	pieceBit, _ := getPiece(sq/8, sq%8, p)
+	own := p.colors[colorIndex(isWhite)]
+	occupied := p.occupied()
+
+	switch pieceBit {
+	case PawnBit:
+		return p.appendPawnMoves(sq, isWhite, moves)
+	case KnightBit:
+		return p.appendTargetMoves(sq, knightAttacks[sq]&^own, isWhite, moves)
+	case BishopBit:
+		return p.appendTargetMoves(sq, bishopAttacks(sq, occupied)&^own, isWhite, moves)
+	case RookBit:
+		return p.appendTargetMoves(sq, rookAttacks(sq, occupied)&^own, isWhite, moves)
+	case QueenBit:
+		return p.appendTargetMoves(sq, (bishopAttacks(sq, occupied)|rookAttacks(sq, occupied))&^own, isWhite, moves)
+	case KingBit:
+		moves = p.appendTargetMoves(sq, kingAttacks[sq]&^own, isWhite, moves)
+		return p.addCastlingMoves(sq/8, sq%8, isWhite, moves)
 	}
+	return moves
+}
 
-	if pieceBit == KnightBit {
-		moves = p.appendMoveIfValid(row, col, row+1, col+2, 0, isWhite, false, true, moves)
-		moves = p.appendMoveIfValid(row, col, row-1, col+2, 0, isWhite, false, true, moves)
-		moves = p.appendMoveIfValid(row, col, row+1, col-2, 0, isWhite, false, true, moves)
-		moves = p.appendMoveIfValid(row, col, row-1, col-2, 0, isWhite, false, true, moves)
-		moves = p.appendMoveIfValid(row, col, row+2, col+1, 0, isWhite, false, true, moves)
-		moves = p.appendMoveIfValid(row, col, row+2, col-1, 0, isWhite, false, true, moves)
-		moves = p.appendMoveIfValid(row, col, row-2, col+1, 0, isWhite, false, true, moves)
-		moves = p.appendMoveIfValid(row, col, row-2, col-1, 0, isWhite, false, true, moves)
+func (p *Position) appendPawnMoves(sq uint8, isWhite bool, moves []Move) []Move {
+	occupied := p.occupied()
+	enemies := p.colors[colorIndex(!isWhite)]
 
+	targets := pawnAttacks[colorIndex(isWhite)][sq] & enemies
+	startRow, promotionRows := uint8(1), rank8
+	oneStep := uint64(1) << (sq + 8)
+	if !isWhite {
+		startRow, promotionRows = 6, rank1
+		oneStep = uint64(1) << (sq - 8)
 	}
 
-	if pieceBit == BishopBit || pieceBit == QueenBit {
-		var candidates []Move
-		var candidates2 []Move
-		var candidates3 []Move
-		var candidates4 []Move
-		for i := uint8(1); i < 8; i++ {
-			candidates = p.appendMoveIfValid(row, col, row+i, col+i, 0, isWhite, false, false, candidates)
-			candidates2 = p.appendMoveIfValid(row, col, row+i, col-i, 0, isWhite, false, false, candidates2)
-			candidates3 = p.appendMoveIfValid(row, col, row-i, col+i, 0, isWhite, false, false, candidates3)
-			candidates4 = p.appendMoveIfValid(row, col, row-i, col-i, 0, isWhite, false, false, candidates4)
-		}
-		moves = append(moves, filterLongMoves(p, candidates)...)
-		moves = append(moves, filterLongMoves(p, candidates2)...)
-		moves = append(moves, filterLongMoves(p, candidates3)...)
-		moves = append(moves, filterLongMoves(p, candidates4)...)
-	}
-
-	if pieceBit == RookBit || pieceBit == QueenBit {
-		var candidates []Move
-		var candidates2 []Move
-		var candidates3 []Move
-		var candidates4 []Move
-		for i := uint8(1); i < 8; i++ {
-			candidates = p.appendMoveIfValid(row, col, row, col+i, 0, isWhite, false, false, candidates)
-			candidates2 = p.appendMoveIfValid(row, col, row, col-i, 0, isWhite, false, false, candidates2)
-			candidates3 = p.appendMoveIfValid(row, col, row-i, col, 0, isWhite, false, false, candidates3)
-			candidates4 = p.appendMoveIfValid(row, col, row+i, col, 0, isWhite, false, false, candidates4)
+	if oneStep&occupied == 0 {
+		targets |= oneStep
+		if sq/8 == startRow {
+			twoSteps := oneStep << 8
+			if !isWhite {
+				twoSteps = oneStep >> 8
+			}
+			if twoSteps&occupied == 0 {
+				targets |= twoSteps
+			}
 		}
-		moves = append(moves, filterLongMoves(p, candidates)...)
-		moves = append(moves, filterLongMoves(p, candidates2)...)
-		moves = append(moves, filterLongMoves(p, candidates3)...)
-		moves = append(moves, filterLongMoves(p, candidates4)...)
 	}
 
-	if pieceBit == KingBit {
-		moves = p.appendMoveIfValid(row, col, row+1, col, 0, isWhite, false, true, moves)
-		moves = p.appendMoveIfValid(row, col, row+1, col+1, 0, isWhite, false, true, moves)
-		moves = p.appendMoveIfValid(row, col, row+1, col-1, 0, isWhite, false, true, moves)
-		moves = p.appendMoveIfValid(row, col, row-1, col, 0, isWhite, false, true, moves)
-		moves = p.appendMoveIfValid(row, col, row-1, col+1, 0, isWhite, false, true, moves)
-		moves = p.appendMoveIfValid(row, col, row-1, col-1, 0, isWhite, false, true, moves)
-		moves = p.appendMoveIfValid(row, col, row, col+1, 0, isWhite, false, true, moves)
-		moves = p.appendMoveIfValid(row, col, row, col-1, 0, isWhite, false, true, moves)
-
-		moves = p.addCastlingMoves(row, col, isWhite, moves)
+	if targets&promotionRows == 0 {
+		return p.appendTargetMoves(sq, targets, isWhite, moves)
 	}
 
-	//printMoves(moves, "GetPossibleMoves")
-
+	// Handle promotion
+	for targets != 0 {
+		to := popLSB(&targets)
+		isCapture := enemies&(uint64(1)<<to) != 0
+		for _, pieceToPromote := range piecesToPromote {
+			moves = append(moves, newMove(sq, to, isWhite, isCapture, createPiece(pieceToPromote, isWhite)))
+		}
+	}
 	return moves
 }
 
+// isLegal checks a pseudo legal move: castling must not start from or pass through an attacked square,
+// and no move may leave the own king attacked
+func (p *Position) isLegal(move *Move) bool {
+	if move.fromCol == 4 && absDiff(move.fromCol, move.toCol) > 1 && p.squares[squareIndex(move.fromRow, move.fromCol)]&KingBit != 0 {
+		if isKingAttacked(p, move.isWhite) {
+			return false
+		}
+		passedCol := (move.fromCol + move.toCol) / 2
+		if isSquareAttacked(p, squareIndex(move.fromRow, passedCol), !move.isWhite) {
+			return false
+		}
+	}
+	return !p.leavesKingAttacked(move)
+}
+
 func createEnPassantMove(fromRow, fromCol, toRow, toCol uint8, isWhite bool, p *Position) (*Move, bool) {
 	if isSquareOutsideTheBoard(fromRow, fromCol) || isSquareOutsideTheBoard(toRow, toCol) {
 		return nil, false
@@ -193,7 +156,7 @@ func createEnPassantMove(fromRow, fromCol, toRow, toCol uint8, isWhite bool, p *
 	if toPiece, _ := getPiece(toRow, toCol, p); toPiece != 0 {
 		return nil, false
 	}
-	return &Move{
+	move := &Move{
 		fromRow:     fromRow,
 		fromCol:     fromCol,
 		toRow:       toRow,
@@ -201,11 +164,16 @@ func createEnPassantMove(fromRow, fromCol, toRow, toCol uint8, isWhite bool, p *
 		isWhite:     isWhite,
 		isCapture:   true,
 		isEnPassant: true,
-	}, true
+	}
+	// removing both pawns from the row may expose the king
+	if p.leavesKingAttacked(move) {
+		return nil, false
+	}
+	return move, true
 }
 
 func addElPassantMoveIfPossible(moves []Move, p *Position, jumpingPawnCol uint8, white bool) []Move {
-	if jumpingPawnCol == 0 {
+	if jumpingPawnCol == noDoubleStep {
 		return moves
 	}
 	if white {
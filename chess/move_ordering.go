@@ -0,0 +1,130 @@
+package chess
+
+import (
+	"sort"
+)
+
+// maxPly bounds the distance from the root that the search keeps killer moves for
+const maxPly = 128
+
+// The move order scores: the hash move first, then captures and promotions that don't lose material by MVV-LVA,
+// then the killer moves, the losing captures and the rest of the quiet moves by their history score
+const (
+	hashMoveScore      = 1 << 30
+	captureScore       = 1 << 20
+	firstKillerScore   = 1 << 19
+	secondKillerScore  = firstKillerScore - 1
+	losingCaptureScore = 1 << 18
+	// historyMax keeps the history scores below the losing captures
+	historyMax = 1 << 18
+)
+
+// moveOrdering holds what the search learned about the quiet moves that cause cutoffs
+type moveOrdering struct {
+	// killers are the last two quiet moves that caused a cutoff at every ply, in any position
+	killers [maxPly][2]Move
+	// history is indexed by color and by the from and to squares
+	history [2][64][64]int
+}
+
+// moveOrderingEnabled can be switched off to compare with the plain order of sortMoves
+var moveOrderingEnabled = true
+
+// newSearch keeps the history of the previous search at a lower weight and forgets the killers,
+// since the plies are counted from another root
+func (o *moveOrdering) newSearch() {
+	o.killers = [maxPly][2]Move{}
+	o.ageHistory()
+}
+
+func (o *moveOrdering) orderMoves(p *Position, moves []Move, hashMove *Move, ply int) {
+	if !moveOrderingEnabled {
+		sortMoves(moves)
+		return
+	}
+
+	scores := make([]int, len(moves))
+	for i := range moves {
+		scores[i] = o.scoreMove(p, &moves[i], hashMove, ply)
+	}
+	sort.Stable(movesByScore{moves, scores})
+}
+
+func (o *moveOrdering) scoreMove(p *Position, move *Move, hashMove *Move, ply int) int {
+	switch {
+	case hashMove != nil && isSameMove(move, hashMove):
+		return hashMoveScore
+	case move.isCapture || move.pawnPromotePiece != 0:
+		if p.SEE(move) < 0 {
+			return losingCaptureScore + mvvLva(p, move)
+		}
+		return captureScore + mvvLva(p, move)
+	case ply < maxPly && isSameMove(move, &o.killers[ply][0]):
+		return firstKillerScore
+	case ply < maxPly && isSameMove(move, &o.killers[ply][1]):
+		return secondKillerScore
+	}
+	return o.historyScore(move)
+}
+
+// cutoff remembers a quiet move that refuted the position
+func (o *moveOrdering) cutoff(move *Move, depth int, ply int) {
+	if move.isCapture || move.pawnPromotePiece != 0 {
+		return
+	}
+
+	if ply < maxPly && !isSameMove(move, &o.killers[ply][0]) {
+		o.killers[ply][1] = o.killers[ply][0]
+		o.killers[ply][0] = *move
+	}
+
+	history := &o.history[colorIndex(move.isWhite)][squareIndex(move.fromRow, move.fromCol)][squareIndex(move.toRow, move.toCol)]
+	*history += depth * depth
+	if *history >= historyMax {
+		o.ageHistory()
+	}
+}
+
+func (o *moveOrdering) ageHistory() {
+	for c := range o.history {
+		for from := range o.history[c] {
+			for to := range o.history[c][from] {
+				o.history[c][from][to] /= 2
+			}
+		}
+	}
+}
+
+// mvvLva orders the captures by the most valuable victim first, and among them by the least valuable attacker.
+// Promotions count as capturing the new piece.
+func mvvLva(p *Position, move *Move) int {
+	attacker, _ := getPiece(move.fromRow, move.fromCol, p)
+	victim, _ := getPiece(move.toRow, move.toCol, p)
+	if move.isEnPassant {
+		victim = PawnBit
+	}
+	score := 10*int(pieceCost[victim]) - int(pieceCost[attacker])
+	if move.pawnPromotePiece != 0 {
+		score += 10 * int(pieceCost[move.pawnPromotePiece & ^isWhiteBit])
+	}
+	return score
+}
+
+// movesByScore sorts the moves by descending score
+type movesByScore struct {
+	moves  []Move
+	scores []int
+}
+
+func (m movesByScore) Len() int {
+	return len(m.moves)
+}
+
+func (m movesByScore) Less(i, j int) bool {
+	return m.scores[i] > m.scores[j]
+}
+
+func (m movesByScore) Swap(i, j int) {
+	m.moves[i], m.moves[j] = m.moves[j], m.moves[i]
+	m.scores[i], m.scores[j] = m.scores[j], m.scores[i]
+}
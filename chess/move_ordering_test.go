@@ -0,0 +1,60 @@
+package chess
+
+import (
+	"testing"
+)
+
+func TestOrderMoves(t *testing.T) {
+	p := mustParseFEN(t, "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	moves := p.GetAllMoves()
+	find := func(uciMove string) *Move {
+		for i := range moves {
+			if moveToUCI(moves[i]) == uciMove {
+				return &moves[i]
+			}
+		}
+		t.Fatalf("%s isn't legal", uciMove)
+		return nil
+	}
+
+	var o moveOrdering
+	hashMove := *find("a2a3")
+	o.cutoff(find("a1b1"), 3, 1)
+	o.cutoff(find("e1d1"), 3, 1)
+	o.cutoff(find("a1b1"), 3, 1)
+	o.cutoff(find("g2g3"), 3, 2)
+
+	o.orderMoves(p, moves, &hashMove, 1)
+	if moveToUCI(moves[0]) != "a2a3" {
+		t.Errorf("expected the hash move first, got %s", moveToUCI(moves[0]))
+	}
+
+	// the captures that don't lose material by MVV-LVA, the killers of ply 1, most recent first,
+	// the captures that lose material, and then the history moves
+	expected := []string{"e2a6", "g2h3", "d5e6", "a1b1", "e1d1", "f3f6", "e5g6", "e5d7", "e5f7", "f3h3", "g2g3"}
+	for i, uciMove := range expected {
+		if got := moveToUCI(moves[1+i]); got != uciMove {
+			t.Errorf("expected %s at %d, got %s", uciMove, 1+i, got)
+		}
+	}
+}
+
+// BenchmarkSearchNodes reports the nodes a fixed depth search needs, without and with move ordering
+func BenchmarkSearchNodes(b *testing.B) {
+	for _, ordered := range []bool{false, true} {
+		name := "toInt order"
+		if ordered {
+			name = "move ordering"
+		}
+		b.Run(name, func(b *testing.B) {
+			moveOrderingEnabled = ordered
+			defer func() { moveOrderingEnabled = true }()
+
+			nodes := uint64(0)
+			for i := 0; i < b.N; i++ {
+				nodes += searchPerftPositions(b, 4, nil)
+			}
+			b.ReportMetric(float64(nodes)/float64(b.N), "nodes/op")
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package chess
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Perft counts the leaf nodes of the legal move tree of the given depth.
+// It is used to verify the move generator against known node counts.
+func (p *Position) Perft(depth int) uint64 {
+	if depth == 0 {
+		return 1
+	}
+
+	moves := p.GetAllMoves()
+	if depth == 1 {
+		return uint64(len(moves))
+	}
+
+	nodes := uint64(0)
+	for i := range moves {
+		p.MakeMove(&moves[i])
+		nodes += p.Perft(depth - 1)
+		p.UnmakeMove()
+	}
+	return nodes
+}
+
+// PerftDivide returns the perft node count below every root move, keyed by the move in UCI notation
+func (p *Position) PerftDivide(depth int) map[string]uint64 {
+	res := make(map[string]uint64)
+	if depth < 1 {
+		return res
+	}
+
+	moves := p.GetAllMoves()
+	for i := range moves {
+		p.MakeMove(&moves[i])
+		res[moveToUCI(moves[i])] = p.Perft(depth - 1)
+		p.UnmakeMove()
+	}
+	return res
+}
+
+func handlePerft(game *Game, depth int) {
+	divide := game.position.PerftDivide(depth)
+
+	uciMoves := make([]string, 0, len(divide))
+	for uciMove := range divide {
+		uciMoves = append(uciMoves, uciMove)
+	}
+	sort.Strings(uciMoves)
+
+	total := uint64(0)
+	for _, uciMove := range uciMoves {
+		total += divide[uciMove]
+		game.output.send(fmt.Sprintf("%s: %d", uciMove, divide[uciMove]))
+	}
+	game.output.send("")
+	game.output.send(fmt.Sprintf("Nodes searched: %d", total))
+	game.output.send("")
+}
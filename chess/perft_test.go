@@ -0,0 +1,82 @@
+package chess
+
+import (
+	"testing"
+)
+
+// searchPerftPositions searches every perft position depth plies deep from an empty transposition table,
+// with a fixed seed and without the random part of the evaluation so the searches repeat. check, if any,
+// gets the principal variation of every position, it returns the nodes of all the searches.
+func searchPerftPositions(tb testing.TB, depth int, check func(name string, p *Position, line []*Move)) uint64 {
+	defer func(seed int) { RandomSeed = seed }(RandomSeed)
+	RandomSeed = 1
+
+	nodes := uint64(0)
+	for _, tt := range perftPositions {
+		p, err := ParseFEN(tt.fen)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		game := new(Game)
+		game.InitGameFromPosition(p, depth)
+		game.noise.max = 0
+		transpositionTable.Clear()
+		line, _ := MakeMove(depth, game)
+		nodes += game.timer.nodes
+		if check != nil {
+			check(tt.name, p, line)
+		}
+	}
+	return nodes
+}
+
+// Reference node counts from https://www.chessprogramming.org/Perft_Results
+var perftPositions = []struct {
+	name   string
+	fen    string
+	depth  int
+	leaves uint64
+}{
+	{"Start", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", 5, 4865609},
+	{"Kiwipete", "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", 4, 4085603},
+	{"Position3", "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", 5, 674624},
+	{"Position4", "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1", 4, 422333},
+	{"Position5", "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8", 4, 2103487},
+	{"Position6", "r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10", 4, 3894594},
+}
+
+func TestPerft(t *testing.T) {
+	for _, tt := range perftPositions {
+		t.Run(tt.name, func(t *testing.T) {
+			e, _ := newTestEngine()
+			e.HandleCommand("ucinewgame")
+			e.HandleCommand("position fen " + tt.fen)
+
+			if leaves := e.game.position.Perft(tt.depth); leaves != tt.leaves {
+				t.Errorf("Perft(%d) = %d, expected %d", tt.depth, leaves, tt.leaves)
+			}
+		})
+	}
+}
+
+func TestPerftDivide(t *testing.T) {
+	e, _ := newTestEngine()
+	e.HandleCommand("ucinewgame")
+	e.HandleCommand("position startpos moves e2e4")
+
+	divide := e.game.position.PerftDivide(2)
+	if len(divide) != 20 {
+		t.Errorf("Expected 20 root moves, got %d", len(divide))
+	}
+
+	total := uint64(0)
+	for _, nodes := range divide {
+		total += nodes
+	}
+	if total != 600 {
+		t.Errorf("Expected 600 nodes, got %d", total)
+	}
+	if divide["e7e5"] != 29 {
+		t.Errorf("Expected 29 nodes after e7e5, got %d", divide["e7e5"])
+	}
+}
@@ -3,7 +3,7 @@ package chess
 import (
 	"fmt"
 	"log"
-	"slices"
+	"math/bits"
 	"strings"
 	"unicode"
 )
@@ -16,6 +16,9 @@ const QueenBit = byte(16)
 const KingBit = byte(32)
 const isWhiteBit = byte(64)
 
+// noDoubleStep marks that no pawn has just made a double step
+const noDoubleStep = uint8(8)
+
 var piecesToPromote = []byte{
 	KnightBit,
 	BishopBit,
@@ -24,11 +27,19 @@ var piecesToPromote = []byte{
 }
 
 type Position struct {
-	board     [8][8]uint8
-	moveNum   int8
+	// bitboards of all the pieces of a type (see pieceIndex) and of all the pieces of a color (see colorIndex)
+	pieces [6]uint64
+	colors [2]uint64
+	// the piece with color on every square, for quick lookups by square
+	squares [64]uint8
+
+	// the fullmove number, starting at 1 and incremented after black's move
+	moveNum   int
 	whiteTurn bool
+	// plies since the last pawn move or capture, for the fifty-move rule
+	halfmoveClock int
 
-	evaluation  float32
+	evaluation  Score
 	isCheckmate bool
 
 	whiteShortCastleAllowed bool
@@ -36,7 +47,7 @@ type Position struct {
 	whiteLongCastleAllowed  bool
 	blackLongCastleAllowed  bool
 
-	//used for en passant
+	//used for en passant, noDoubleStep when the last move wasn't a pawn double step
 	whitePawnDoubleStepCol uint8
 	blackPawnDoubleStepCol uint8
 
@@ -48,6 +59,28 @@ type Position struct {
 	availableMoves  []Move
 
 	hash uint64
+
+	// one entry for every move made with MakeMove, used by UnmakeMove
+	undoStack []undoInfo
+}
+
+// undoInfo holds what MakeMove can't derive back from the move
+type undoInfo struct {
+	move          Move
+	capturedPiece uint8
+
+	whiteShortCastleAllowed bool
+	blackShortCastleAllowed bool
+	whiteLongCastleAllowed  bool
+	blackLongCastleAllowed  bool
+	whitePawnDoubleStepCol  uint8
+	blackPawnDoubleStepCol  uint8
+
+	halfmoveClock  int
+	evaluation     Score
+	isCheckmate    bool
+	availableMoves []Move
+	hash           uint64
 }
 
 type Move struct {
@@ -79,10 +112,8 @@ func (m Move) String() string {
 }
 
 func printMoves(moves []Move, prefix string) {
-	if Debug {
-		for i, m := range moves {
-			println(i, ". ", prefix, " - ", m.String())
-		}
+	for i, m := range moves {
+		println(i, ". ", prefix, " - ", m.String())
 	}
 }
 
@@ -95,43 +126,52 @@ func (m Move) Equal(other Move) bool {
 }
 
 type PositionOperations interface {
-	InitPosition(board *[8][8]string, moveNum int8, turnWhite bool) *Position
+	InitPosition(board *[8][8]string, moveNum int, turnWhite bool) *Position
 	PrintPosition()
 	IsValidMove(move *Move) bool
 	GetAllMoves() []Move
-	Evaluate(prevPos *Position, move *Move, positionHashes map[uint64]bool) float32
+	Evaluate() Score
 }
 
 func isWhitePiece(piece uint8) bool {
 	return piece&isWhiteBit != 0
 }
 
-func isVacantSquare(board [8][8]uint8, row uint8, col uint8) bool {
-	return board[row][col] == 0
+func isVacantSquare(p *Position, row uint8, col uint8) bool {
+	return p.squares[squareIndex(row, col)] == 0
 }
 
-func filterLongMoves(position *Position, moves []Move) []Move {
-	var res []Move
+func getPiece(row uint8, col uint8, p *Position) (uint8, bool) {
+	piece := p.squares[squareIndex(row, col)]
+	pieceBit := piece & ^isWhiteBit
+	return pieceBit, piece&isWhiteBit != 0
+}
 
-	for _, move := range moves {
-		piece, w := getPiece(move.toRow, move.toCol, position)
-		if piece != 0 {
-			if w != move.isWhite {
-				res = append(res, move)
-			}
-			break
-		}
-		res = append(res, move)
-	}
+func (p *Position) occupied() uint64 {
+	return p.colors[0] | p.colors[1]
+}
 
-	return res
+// piecesOf returns the bitboard of the pieces of a type and color
+func (p *Position) piecesOf(piece uint8, isWhite bool) uint64 {
+	return p.pieces[pieceIndex(piece)] & p.colors[colorIndex(isWhite)]
 }
 
-func getPiece(row uint8, col uint8, p *Position) (uint8, bool) {
-	board := p.board
-	piece := board[row][col]
-	pieceBit := piece & ^isWhiteBit
-	return pieceBit, piece&isWhiteBit != 0
+func (p *Position) putPiece(sq uint8, piece uint8, isWhite bool) {
+	bit := uint64(1) << sq
+	p.pieces[pieceIndex(piece)] |= bit
+	p.colors[colorIndex(isWhite)] |= bit
+	p.squares[sq] = createPiece(piece, isWhite)
+}
+
+func (p *Position) removePiece(sq uint8) {
+	pieceWithColor := p.squares[sq]
+	if pieceWithColor == 0 {
+		return
+	}
+	bit := uint64(1) << sq
+	p.pieces[pieceIndex(pieceWithColor & ^isWhiteBit)] &^= bit
+	p.colors[colorIndex(isWhitePiece(pieceWithColor))] &^= bit
+	p.squares[sq] = 0
 }
 
 func createPiece(piece uint8, isWhite bool) uint8 {
@@ -142,18 +182,6 @@ func createPiece(piece uint8, isWhite bool) uint8 {
 	}
 }
 
-func (p *Position) applyMoves(moves []Move) []PositionMove {
-	res := make([]PositionMove, len(moves))
-	for i, move := range moves {
-		newPos := ApplyMove(*p, &move)
-		res[i] = PositionMove{
-			pos:  newPos,
-			move: &move,
-		}
-	}
-	return res
-}
-
 func absDiff(a, b uint8) uint8 {
 	if a > b {
 		return a - b
@@ -171,31 +199,35 @@ func (p *Position) IsValidMove(move *Move) bool {
 		return false
 	}
 
-	fromPieceWithColor := p.board[move.fromRow][move.fromCol]
+	fromPieceWithColor := p.squares[squareIndex(move.fromRow, move.fromCol)]
 	fromPiece, _ := getPiece(move.fromRow, move.fromCol, p)
 	if fromPieceWithColor == 0 || (move.isWhite && !isWhitePiece(fromPieceWithColor)) ||
 		(!move.isWhite && isWhitePiece(fromPieceWithColor)) {
 		return false
 	}
 
-	toPieceWithColor := p.board[move.toRow][move.toCol]
+	toPieceWithColor := p.squares[squareIndex(move.toRow, move.toCol)]
 	if toPieceWithColor != 0 && (move.isWhite == isWhitePiece(toPieceWithColor)) {
 		return false
 	}
 
-	if move.isCapture && isVacantSquare(p.board, move.toRow, move.toCol) {
+	if move.isCapture && isVacantSquare(p, move.toRow, move.toCol) {
 		return false
 	}
 
-	if !move.isCapture && !isVacantSquare(p.board, move.toRow, move.toCol) {
+	if !move.isCapture && !isVacantSquare(p, move.toRow, move.toCol) {
 		return false
 	}
 
-	//if the move is a castle and a king is attacked, the move is invalid
+	//if the move is a castle and the king is attacked or passes through an attacked square, the move is invalid
 	if fromPiece == KingBit && absDiff(move.fromCol, move.toCol) > 1 {
 		if isKingAttacked(p, p.whiteTurn) {
 			return false
 		}
+		passedCol := (move.fromCol + move.toCol) / 2
+		if isSquareAttacked(p, squareIndex(move.fromRow, passedCol), !p.whiteTurn) {
+			return false
+		}
 	}
 
 	// if the pawn jumps by 2 rows, check that the square it jumps over is not occupied
@@ -212,25 +244,17 @@ func (p *Position) IsValidMove(move *Move) bool {
 
 	}
 
-	//todo this copies the entire board - should be done with pointers
-	newPos := ApplyMove(*p, move)
-	if isKingAttacked(newPos, move.isWhite) {
-		return false
-	}
-
-	return true
+	return !p.leavesKingAttacked(move)
 }
 
-func getFirstPiece(p *Position, row int8, col int8, dirX int8, dirY int8) [2]int8 {
-	row = row + dirX
-	col = col + dirY
-	if !isInsideBoard(row, col) {
-		return [2]int8{9, 9}
-	}
-	if p.board[row][col] != 0 {
-		return [2]int8{row, col}
-	}
-	return getFirstPiece(p, row, col, dirX, dirY)
+// leavesKingAttacked checks whether the king of the moving side is attacked after the move
+func (p *Position) leavesKingAttacked(move *Move) bool {
+	// the hash isn't needed here, UnmakeMove restores it anyway
+	p.pushUndo(move)
+	ApplyMovePointers(p, move)
+	attacked := isKingAttacked(p, move.isWhite)
+	p.UnmakeMove()
+	return attacked
 }
 
 func isInsideBoard(row int8, col int8) bool {
@@ -238,62 +262,39 @@ func isInsideBoard(row int8, col int8) bool {
 }
 
 func isKingAttacked(p *Position, isWhite bool) bool {
-
-	isCorrectPiece := func(p *Position, locations [][2]int8, pieces []uint8, isWhite bool) bool {
-		for _, location := range locations {
-			if isInsideBoard(location[0], location[1]) {
-				actualP, w := getPiece(uint8(location[0]), uint8(location[1]), p)
-				if slices.Contains(pieces, actualP) && w == isWhite {
-					return true
-				}
-			}
-		}
-		return false
-	}
-
-	i := int8(p.whiteKingPosRow)
-	j := int8(p.whiteKingPosCol)
+	row, col := p.whiteKingPosRow, p.whiteKingPosCol
 	if !isWhite {
-		i = int8(p.blackKingPosRow)
-		j = int8(p.blackKingPosCol)
+		row, col = p.blackKingPosRow, p.blackKingPosCol
 	}
 
-	piece, white := getPiece(uint8(i), uint8(j), p)
+	piece, white := getPiece(row, col, p)
 	if white == isWhite && piece == KingBit {
-		locs := [][2]int8{{i + 1, j + 1}, {i + 1, j - 1}, {i + 1, j},
-			{i - 1, j + 1}, {i - 1, j}, {i - 1, j - 1},
-			{i, j + 1}, {i, j - 1}}
-		if isCorrectPiece(p, locs, []uint8{KingBit}, !isWhite) {
-			return true
-		}
-
-		if isCorrectPiece(p, [][2]int8{{i + ColorFactorInt(isWhite), j + 1}, {i + ColorFactorInt(isWhite), j - 1}}, []uint8{PawnBit}, !isWhite) {
-			return true
-		}
-
-		locs = [][2]int8{{i + 2, j + 1}, {i + 2, j - 1}, {i - 2, j + 1}, {i - 2, j - 1},
-			{i + 1, j + 2}, {i + 1, j - 2}, {i - 1, j + 2}, {i - 1, j - 2}}
-		if isCorrectPiece(p, locs, []uint8{KnightBit}, !isWhite) {
-			return true
-		}
+		return isSquareAttacked(p, squareIndex(row, col), !isWhite)
+	}
+	return false
+}
 
-		if isCorrectPiece(p, [][2]int8{getFirstPiece(p, i, j, 1, 1)}, []uint8{BishopBit, QueenBit}, !isWhite) ||
-			isCorrectPiece(p, [][2]int8{getFirstPiece(p, i, j, 1, -1)}, []uint8{BishopBit, QueenBit}, !isWhite) ||
-			isCorrectPiece(p, [][2]int8{getFirstPiece(p, i, j, -1, 1)}, []uint8{BishopBit, QueenBit}, !isWhite) ||
-			isCorrectPiece(p, [][2]int8{getFirstPiece(p, i, j, -1, -1)}, []uint8{BishopBit, QueenBit}, !isWhite) {
-			return true
-		}
+// isSquareAttacked checks whether any piece of the given color attacks the square
+func isSquareAttacked(p *Position, sq uint8, byWhite bool) bool {
+	attackers := p.colors[colorIndex(byWhite)]
 
-		if isCorrectPiece(p, [][2]int8{getFirstPiece(p, i, j, 1, 0)}, []uint8{RookBit, QueenBit}, !isWhite) ||
-			isCorrectPiece(p, [][2]int8{getFirstPiece(p, i, j, 0, 1)}, []uint8{RookBit, QueenBit}, !isWhite) ||
-			isCorrectPiece(p, [][2]int8{getFirstPiece(p, i, j, -1, 0)}, []uint8{RookBit, QueenBit}, !isWhite) ||
-			isCorrectPiece(p, [][2]int8{getFirstPiece(p, i, j, 0, -1)}, []uint8{RookBit, QueenBit}, !isWhite) {
-			return true
-		}
+	// a pawn of the attacking color stands where a pawn of the other color on sq would attack
+	if pawnAttacks[colorIndex(!byWhite)][sq]&attackers&p.pieces[pieceIndex(PawnBit)] != 0 {
+		return true
+	}
+	if knightAttacks[sq]&attackers&p.pieces[pieceIndex(KnightBit)] != 0 {
+		return true
+	}
+	if kingAttacks[sq]&attackers&p.pieces[pieceIndex(KingBit)] != 0 {
+		return true
+	}
 
-		return false
+	queens := p.pieces[pieceIndex(QueenBit)]
+	occupied := p.occupied()
+	if bishopAttacks(sq, occupied)&attackers&(p.pieces[pieceIndex(BishopBit)]|queens) != 0 {
+		return true
 	}
-	return false
+	return rookAttacks(sq, occupied)&attackers&(p.pieces[pieceIndex(RookBit)]|queens) != 0
 }
 
 func moveOutsideBoard(move *Move) bool {
@@ -301,16 +302,16 @@ func moveOutsideBoard(move *Move) bool {
 }
 
 func (p *Position) GetAllMoves() []Move {
-	var validMoves []Move
-
-	for row := 0; row < 8; row++ {
-		for col := 0; col < 8; col++ {
-			moves := p.GetPossibleMoves(uint8(row), uint8(col), p.whiteTurn)
-			for _, move := range moves {
-				if p.IsValidMove(&move) {
-					validMoves = append(validMoves, move)
-				}
-			}
+	moves := make([]Move, 0, 48)
+	for own := p.colors[colorIndex(p.whiteTurn)]; own != 0; {
+		sq := popLSB(&own)
+		moves = p.appendPieceMoves(sq, p.whiteTurn, moves)
+	}
+
+	validMoves := moves[:0]
+	for i := range moves {
+		if p.isLegal(&moves[i]) {
+			validMoves = append(validMoves, moves[i])
 		}
 	}
 	validMoves = p.addEnPassantMoves(validMoves)
@@ -334,9 +335,9 @@ func (p *Position) PrintPosition() {
 		strPos += fmt.Sprintf("%d ", i+1)
 
 		for j := 0; j < 8; j++ {
-			s := p.board[i][j] & ^(uint8(1) << 6)
+			s, isWhite := getPiece(uint8(i), uint8(j), p)
 			str := PieceToString(s)
-			if s != p.board[i][j] {
+			if isWhite {
 				str = strings.ToUpper(str)
 			}
 			strPos += str
@@ -352,7 +353,7 @@ func (p *Position) PrintPosition() {
 		suffix = "Checkmate! "
 	}
 
-	strPos += fmt.Sprintf("Move: %d, turn white: %t, eval: %f, %s\n", p.moveNum, p.whiteTurn, p.evaluation, suffix)
+	strPos += fmt.Sprintf("Move: %d, turn white: %t, eval: %d, %s\n", p.moveNum, p.whiteTurn, p.evaluation, suffix)
 	strPos += "***************"
 	log.Println(strPos)
 }
@@ -378,19 +379,23 @@ func PieceToString(pieceBit uint8) string {
 	return str
 }
 
-func cloneBoard(original [8][8]uint8) [8][8]uint8 {
-	var clone [8][8]uint8
-	for i := range original {
-		for j := range original[i] {
-			clone[i][j] = original[i][j]
-		}
-	}
-	return clone
-}
-
 func (p *Position) UpdateCastingAllowance(lastMove *Move) {
 	piece, _ := getPiece(lastMove.toRow, lastMove.toCol, p)
 
+	// a rook captured on its initial square can't castle anymore
+	if lastMove.isCapture {
+		switch {
+		case lastMove.toRow == 0 && lastMove.toCol == 0:
+			p.whiteLongCastleAllowed = false
+		case lastMove.toRow == 0 && lastMove.toCol == 7:
+			p.whiteShortCastleAllowed = false
+		case lastMove.toRow == 7 && lastMove.toCol == 0:
+			p.blackLongCastleAllowed = false
+		case lastMove.toRow == 7 && lastMove.toCol == 7:
+			p.blackShortCastleAllowed = false
+		}
+	}
+
 	if piece == KingBit {
 		if lastMove.isWhite {
 			p.whiteShortCastleAllowed = false
@@ -424,19 +429,17 @@ func (p *Position) UpdateCastingAllowance(lastMove *Move) {
 
 }
 
-func convertBoard(board *[8][8]string) [8][8]uint8 {
-	res := [8][8]uint8{}
+// placePieces puts the pieces of a board, given top row (8th rank) first, on the position
+func (p *Position) placePieces(board *[8][8]string) {
 	for i := 0; i < 8; i++ {
 		for j := 0; j < 8; j++ {
 			c := board[i][j]
-			p := PieceStrToPieceBit(c)
-			if len(c) > 0 && unicode.IsUpper([]rune(c)[0]) {
-				p += 64
+			piece := PieceStrToPieceBit(c)
+			if piece != 0 {
+				p.putPiece(squareIndex(uint8(7-i), uint8(j)), piece, unicode.IsUpper([]rune(c)[0]))
 			}
-			res[7-i][j] = p
 		}
 	}
-	return res
 }
 
 func PieceStrToPieceBit(c string) uint8 {
@@ -458,18 +461,18 @@ func PieceStrToPieceBit(c string) uint8 {
 	return p
 }
 
-func (p *Position) InitPosition(board *[8][8]string, moveNum int8, turnWhite bool) *Position {
-	newBoard := convertBoard(board)
-
+func (p *Position) InitPosition(board *[8][8]string, moveNum int, turnWhite bool) *Position {
 	pos := Position{
-		board:                   newBoard,
 		moveNum:                 moveNum,
 		whiteTurn:               turnWhite,
 		whiteLongCastleAllowed:  true,
 		whiteShortCastleAllowed: true,
 		blackLongCastleAllowed:  true,
 		blackShortCastleAllowed: true,
+		whitePawnDoubleStepCol:  noDoubleStep,
+		blackPawnDoubleStepCol:  noDoubleStep,
 	}
+	pos.placePieces(board)
 
 	for i := uint8(0); i < 8; i++ {
 		for j := uint8(0); j < 8; j++ {
@@ -489,6 +492,30 @@ func (p *Position) InitPosition(board *[8][8]string, moveNum int8, turnWhite boo
 	return &pos
 }
 
+// IsFiftyMoveDraw checks whether 50 moves were made by each side without a pawn move or a capture.
+// A checkmate delivered by the last of them still wins.
+func (p *Position) IsFiftyMoveDraw() bool {
+	if p.halfmoveClock < 100 {
+		return false
+	}
+	return !isKingAttacked(p, p.whiteTurn) || len(p.GetAllMoves()) > 0
+}
+
+// IsInsufficientMaterial checks whether neither side can ever checkmate: kings with at most one minor piece,
+// or kings with bishops that all stand on squares of the same color
+func (p *Position) IsInsufficientMaterial() bool {
+	if p.pieces[pieceIndex(PawnBit)]|p.pieces[pieceIndex(RookBit)]|p.pieces[pieceIndex(QueenBit)] != 0 {
+		return false
+	}
+
+	knights := p.pieces[pieceIndex(KnightBit)]
+	bishops := p.pieces[pieceIndex(BishopBit)]
+	if bits.OnesCount64(knights|bishops) <= 1 {
+		return true
+	}
+	return knights == 0 && (bishops&lightSquares == 0 || bishops&^lightSquares == 0)
+}
+
 func ApplyMove(p Position, move *Move) *Position {
 	ApplyMovePointers(&p, move)
 	return &p
@@ -496,9 +523,12 @@ func ApplyMove(p Position, move *Move) *Position {
 
 func ClonePosition(p *Position) *Position {
 	return &Position{
-		board:                   cloneBoard(p.board),
+		pieces:                  p.pieces,
+		colors:                  p.colors,
+		squares:                 p.squares,
 		moveNum:                 p.moveNum,
 		whiteTurn:               p.whiteTurn,
+		halfmoveClock:           p.halfmoveClock,
 		evaluation:              p.evaluation,
 		isCheckmate:             p.isCheckmate,
 		availableMoves:          p.availableMoves,
@@ -516,19 +546,163 @@ func ClonePosition(p *Position) *Position {
 	}
 }
 
+// MakeMove applies the move in place, updating the hash, and records what is needed to take it back with UnmakeMove
+func (p *Position) MakeMove(move *Move) {
+	hash := UpdateZobristHash(p.hash, move, p)
+	p.pushUndo(move)
+	ApplyMovePointers(p, move)
+	p.hash = hash
+}
+
+func (p *Position) pushUndo(move *Move) {
+	undo := undoInfo{
+		move:                    *move,
+		whiteShortCastleAllowed: p.whiteShortCastleAllowed,
+		blackShortCastleAllowed: p.blackShortCastleAllowed,
+		whiteLongCastleAllowed:  p.whiteLongCastleAllowed,
+		blackLongCastleAllowed:  p.blackLongCastleAllowed,
+		whitePawnDoubleStepCol:  p.whitePawnDoubleStepCol,
+		blackPawnDoubleStepCol:  p.blackPawnDoubleStepCol,
+		halfmoveClock:           p.halfmoveClock,
+		evaluation:              p.evaluation,
+		isCheckmate:             p.isCheckmate,
+		availableMoves:          p.availableMoves,
+		hash:                    p.hash,
+	}
+	if move.isEnPassant {
+		undo.capturedPiece = p.squares[squareIndex(move.fromRow, move.toCol)]
+	} else {
+		undo.capturedPiece = p.squares[squareIndex(move.toRow, move.toCol)]
+	}
+	p.undoStack = append(p.undoStack, undo)
+}
+
+// UnmakeMove takes back the last move made with MakeMove
+func (p *Position) UnmakeMove() {
+	undo := &p.undoStack[len(p.undoStack)-1]
+	move := &undo.move
+	from := squareIndex(move.fromRow, move.fromCol)
+	to := squareIndex(move.toRow, move.toCol)
+
+	piece, _ := getPiece(move.toRow, move.toCol, p)
+	if move.pawnPromotePiece != 0 {
+		piece = PawnBit
+	}
+	p.removePiece(to)
+	p.putPiece(from, piece, move.isWhite)
+
+	if undo.capturedPiece != 0 {
+		capturedSq := to
+		if move.isEnPassant {
+			capturedSq = squareIndex(move.fromRow, move.toCol)
+		}
+		p.putPiece(capturedSq, undo.capturedPiece & ^isWhiteBit, isWhitePiece(undo.capturedPiece))
+	}
+
+	if piece == KingBit {
+		if move.isWhite {
+			p.whiteKingPosRow = move.fromRow
+			p.whiteKingPosCol = move.fromCol
+		} else {
+			p.blackKingPosRow = move.fromRow
+			p.blackKingPosCol = move.fromCol
+		}
+
+		if move.fromCol > 1+move.toCol {
+			p.removePiece(squareIndex(move.fromRow, 3))
+			p.putPiece(squareIndex(move.fromRow, 0), RookBit, move.isWhite)
+		} else if move.toCol > 1+move.fromCol {
+			p.removePiece(squareIndex(move.fromRow, 5))
+			p.putPiece(squareIndex(move.fromRow, 7), RookBit, move.isWhite)
+		}
+	}
+
+	if !move.isWhite {
+		p.moveNum -= 1
+	}
+	p.popUndo()
+}
+
+// popUndo restores the state that isn't on the board and takes the turn back
+func (p *Position) popUndo() {
+	undo := &p.undoStack[len(p.undoStack)-1]
+	p.whiteShortCastleAllowed = undo.whiteShortCastleAllowed
+	p.blackShortCastleAllowed = undo.blackShortCastleAllowed
+	p.whiteLongCastleAllowed = undo.whiteLongCastleAllowed
+	p.blackLongCastleAllowed = undo.blackLongCastleAllowed
+	p.whitePawnDoubleStepCol = undo.whitePawnDoubleStepCol
+	p.blackPawnDoubleStepCol = undo.blackPawnDoubleStepCol
+	p.halfmoveClock = undo.halfmoveClock
+	p.evaluation = undo.evaluation
+	p.isCheckmate = undo.isCheckmate
+	p.availableMoves = undo.availableMoves
+	p.hash = undo.hash
+
+	p.whiteTurn = !p.whiteTurn
+	p.undoStack = p.undoStack[:len(p.undoStack)-1]
+}
+
+// nullMove is pushed to the undo stack by MakeNullMove, it goes from a1 to a1
+var nullMove = Move{}
+
+// MakeNullMove passes the turn to the other side without moving, for null-move pruning. En passant expires, and
+// the halfmove clock is reset so no repetition is detected across the null move.
+func (p *Position) MakeNullMove() {
+	hash := p.hash
+	if col, ok := p.enPassantCol(); ok {
+		hash ^= zobristEnPassant[col]
+	}
+	hash ^= zobristTurn[whiteTurn] ^ zobristTurn[blackTurn]
+
+	p.pushUndo(&nullMove)
+	p.whitePawnDoubleStepCol = noDoubleStep
+	p.blackPawnDoubleStepCol = noDoubleStep
+	p.halfmoveClock = 0
+	p.whiteTurn = !p.whiteTurn
+	p.hash = hash
+}
+
+// UnmakeNullMove takes back the last MakeNullMove
+func (p *Position) UnmakeNullMove() {
+	p.popUndo()
+}
+
+// lastMoveWasNull checks if the position was reached by MakeNullMove
+func (p *Position) lastMoveWasNull() bool {
+	if len(p.undoStack) == 0 {
+		return false
+	}
+	move := &p.undoStack[len(p.undoStack)-1].move
+	return move.fromRow == move.toRow && move.fromCol == move.toCol
+}
+
+// hasNonPawnMaterial checks if the side has pieces other than the king and pawns
+func (p *Position) hasNonPawnMaterial(isWhite bool) bool {
+	return p.colors[colorIndex(isWhite)]&^(p.pieces[pieceIndex(PawnBit)]|p.pieces[pieceIndex(KingBit)]) != 0
+}
+
 func ApplyMovePointers(p *Position, move *Move) {
-	piece := p.board[move.fromRow][move.fromCol]
+	from := squareIndex(move.fromRow, move.fromCol)
+	to := squareIndex(move.toRow, move.toCol)
 	origPiece, _ := getPiece(move.fromRow, move.fromCol, p)
 
+	if origPiece == PawnBit || move.isCapture || p.squares[to] != 0 {
+		p.halfmoveClock = 0
+	} else {
+		p.halfmoveClock += 1
+	}
+
 	// regular move
+	piece := origPiece
 	if move.pawnPromotePiece != 0 {
-		piece = move.pawnPromotePiece
+		piece = move.pawnPromotePiece & ^isWhiteBit
 	}
-	p.board[move.toRow][move.toCol] = piece
-	p.board[move.fromRow][move.fromCol] = 0
+	p.removePiece(to)
+	p.removePiece(from)
+	p.putPiece(to, piece, move.isWhite)
 
 	if move.isEnPassant {
-		p.board[move.fromRow][move.toCol] = 0
+		p.removePiece(squareIndex(move.fromRow, move.toCol))
 	}
 
 	if origPiece == KingBit {
@@ -542,11 +716,11 @@ func ApplyMovePointers(p *Position, move *Move) {
 
 		if move.fromCol > 1+move.toCol || move.toCol > 1+move.fromCol {
 			if move.fromCol > move.toCol {
-				p.board[move.fromRow][3] = p.board[move.fromRow][0]
-				p.board[move.fromRow][0] = 0
+				p.removePiece(squareIndex(move.fromRow, 0))
+				p.putPiece(squareIndex(move.fromRow, 3), RookBit, move.isWhite)
 			} else {
-				p.board[move.fromRow][5] = p.board[move.fromRow][7]
-				p.board[move.fromRow][7] = 0
+				p.removePiece(squareIndex(move.fromRow, 7))
+				p.putPiece(squareIndex(move.fromRow, 5), RookBit, move.isWhite)
 			}
 		}
 	}
@@ -559,83 +733,16 @@ func ApplyMovePointers(p *Position, move *Move) {
 		}
 	} else {
 		if move.isWhite {
-			p.whitePawnDoubleStepCol = 0
+			p.whitePawnDoubleStepCol = noDoubleStep
 		} else {
-			p.blackPawnDoubleStepCol = 0
+			p.blackPawnDoubleStepCol = noDoubleStep
 		}
 	}
 
 	p.UpdateCastingAllowance(move)
 
 	p.whiteTurn = !p.whiteTurn
-	p.moveNum += 1
-}
-
-// positionToFEN converts a Position struct to a FEN string.
-func (p *Position) positionToFEN() string {
-	var sb strings.Builder
-
-	// Board layout
-	for row := 7; row >= 0; row-- {
-		emptyCount := 0
-		for col := 0; col < 8; col++ {
-			piece, isWhite := getPiece(uint8(row), uint8(col), p)
-			if piece == 0 {
-				emptyCount++
-			} else {
-				if emptyCount > 0 {
-					sb.WriteString(fmt.Sprintf("%d", emptyCount))
-					emptyCount = 0
-				}
-				pieceStr := PieceToString(piece)
-				if isWhite {
-					pieceStr = strings.ToUpper(pieceStr)
-				}
-				sb.WriteString(pieceStr)
-			}
-		}
-		if emptyCount > 0 {
-			sb.WriteString(fmt.Sprintf("%d", emptyCount))
-		}
-		if row > 0 {
-			sb.WriteString("/")
-		}
-	}
-
-	// Active color
-	if p.whiteTurn {
-		sb.WriteString(" w ")
-	} else {
-		sb.WriteString(" b ")
+	if !move.isWhite {
+		p.moveNum += 1
 	}
-
-	// Castling availability
-	castling := ""
-	if p.whiteShortCastleAllowed {
-		castling += "K"
-	}
-	if p.whiteLongCastleAllowed {
-		castling += "Q"
-	}
-	if p.blackShortCastleAllowed {
-		castling += "k"
-	}
-	if p.blackLongCastleAllowed {
-		castling += "q"
-	}
-	if castling == "" {
-		castling = "-"
-	}
-	sb.WriteString(castling + " ")
-
-	// En passant target square (not implemented, so default to "-")
-	sb.WriteString("- ")
-
-	// Halfmove clock (not in struct, default to 0)
-	sb.WriteString("0 ")
-
-	// Fullmove number
-	sb.WriteString(fmt.Sprintf("%d", p.moveNum))
-
-	return sb.String()
 }
@@ -0,0 +1,56 @@
+package chess
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnmakeMoveRestoresPosition(t *testing.T) {
+	for _, tt := range perftPositions {
+		e, _ := newTestEngine()
+		e.HandleCommand("ucinewgame")
+		e.HandleCommand("position fen " + tt.fen)
+		p := e.game.position
+		p.hash = ComputeZobristHash(p)
+
+		moves := p.GetAllMoves()
+		for i := range moves {
+			before := *ClonePosition(p)
+			p.MakeMove(&moves[i])
+			p.UnmakeMove()
+			after := *ClonePosition(p)
+
+			if !reflect.DeepEqual(before, after) {
+				t.Errorf("%s: position after %s wasn't restored", tt.name, moves[i].String())
+			}
+		}
+	}
+}
+
+func TestIsInsufficientMaterial(t *testing.T) {
+	tests := []struct {
+		fen          string
+		insufficient bool
+	}{
+		{"8/8/4k3/8/8/3K4/8/8 w - - 0 1", true},
+		{"8/8/4k3/8/8/3KB3/8/8 w - - 0 1", true},
+		{"8/8/4k3/8/8/3KN3/8/8 b - - 0 1", true},
+		{"8/8/3bk3/8/8/3KB3/8/8 w - - 0 1", true},
+		{"8/8/2b1k3/8/8/3KB3/8/8 w - - 0 1", false},
+		{"8/8/4k3/8/8/3KBB2/8/8 w - - 0 1", false},
+		{"8/8/4k3/8/8/3KNN2/8/8 w - - 0 1", false},
+		{"8/8/3nk3/8/8/3KB3/8/8 w - - 0 1", false},
+		{"8/8/4k3/8/8/3KP3/8/8 w - - 0 1", false},
+		{"8/8/3k4/8/8/3KR3/8/8 w - - 0 1", false},
+		{"8/8/4k3/8/8/3Kq3/8/8 w - - 0 1", false},
+	}
+	for _, tt := range tests {
+		p, err := ParseFEN(tt.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.IsInsufficientMaterial() != tt.insufficient {
+			t.Errorf("IsInsufficientMaterial(%q) should be %t", tt.fen, tt.insufficient)
+		}
+	}
+}
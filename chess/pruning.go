@@ -0,0 +1,64 @@
+package chess
+
+// The selective search techniques of MinimaxTree, switchable through the UCI options of the same names
+var NullMovePruning = true
+var LateMoveReductions = true
+var FutilityPruning = true
+
+// futilityMargin is how much a quiet move is expected to gain at most, per ply of remaining depth
+const futilityMargin = PawnScore
+
+// maxFutilityDepth is the highest remaining depth futility and reverse futility pruning are used at
+const maxFutilityDepth = 3
+
+// nullMoveMinDepth is the lowest remaining depth a null move is tried at
+const nullMoveMinDepth = 3
+
+// lmrMinDepth and lmrMinMoves are the lowest remaining depth and move index late moves are reduced from
+const lmrMinDepth = 3
+const lmrMinMoves = 3
+
+// sideEval converts an evaluation for white to an evaluation for the given side
+func sideEval(eval Score, isWhite bool) Score {
+	return ColorFactor(isWhite) * eval
+}
+
+// sideBounds returns the alpha-beta window from the point of view of the given side
+func sideBounds(lowerBoundEval, upperBoundEval Score, isWhite bool) (Score, Score) {
+	if isWhite {
+		return lowerBoundEval, upperBoundEval
+	}
+	return -upperBoundEval, -lowerBoundEval
+}
+
+// canTryNullMove checks if passing the turn is a safe test of the position: in zugzwang, which is common when
+// only pawns are left, passing would be the best move
+func canTryNullMove(p *Position, depth int, inCheck bool) bool {
+	return NullMovePruning && depth >= nullMoveMinDepth && !inCheck && !p.lastMoveWasNull() && p.hasNonPawnMaterial(p.whiteTurn)
+}
+
+// nullMoveReduction is the depth the null move search is reduced by besides the ply of the null move
+func nullMoveReduction(depth int) int {
+	return 2 + depth/6
+}
+
+// lateMoveReduction returns how many plies less a quiet move late in the order is searched with.
+// Moves with a good history are reduced less.
+func (o *moveOrdering) lateMoveReduction(move *Move, index int, depth int) int {
+	reduction := 1
+	if index >= 2*lmrMinMoves && depth > lmrMinDepth {
+		reduction++
+	}
+	if o.historyScore(move) >= historyMax/8 {
+		reduction--
+	}
+	return reduction
+}
+
+func (o *moveOrdering) historyScore(move *Move) int {
+	return o.history[colorIndex(move.isWhite)][squareIndex(move.fromRow, move.fromCol)][squareIndex(move.toRow, move.toCol)]
+}
+
+func (o *moveOrdering) isKiller(move *Move, ply int) bool {
+	return ply < maxPly && (isSameMove(move, &o.killers[ply][0]) || isSameMove(move, &o.killers[ply][1]))
+}
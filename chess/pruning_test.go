@@ -0,0 +1,94 @@
+package chess
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNullMove(t *testing.T) {
+	InitZobrist()
+	fens := []string{
+		"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R b KQkq - 5 1",
+	}
+	for _, fen := range fens {
+		p := mustParseFEN(t, fen)
+		p.hash = ComputeZobristHash(p)
+		before := *ClonePosition(p)
+
+		p.MakeNullMove()
+		if p.whiteTurn == before.whiteTurn || !p.lastMoveWasNull() {
+			t.Errorf("%s: expected the turn to pass", fen)
+		}
+		if p.hash != ComputeZobristHash(p) {
+			t.Errorf("%s: wrong hash after the null move", fen)
+		}
+		if moves := p.GetAllMoves(); len(moves) == 0 {
+			t.Errorf("%s: expected moves for the other side", fen)
+		}
+
+		p.UnmakeNullMove()
+		if after := *ClonePosition(p); !reflect.DeepEqual(before, after) {
+			t.Errorf("%s: position wasn't restored after the null move", fen)
+		}
+	}
+}
+
+func TestCanTryNullMove(t *testing.T) {
+	defer func() { NullMovePruning = true }()
+
+	tests := []struct {
+		name     string
+		fen      string
+		expected bool
+	}{
+		{"middlegame", "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", true},
+		{"pawn ending", "8/5k2/3p4/1p1Pp2p/pP2Pp1P/P4P1K/8/8 b - - 0 1", false},
+		// black may pass with the rook, white's pawn ending doesn't matter
+		{"rook against pawns", "8/5k2/8/1r6/8/5P1K/6P1/8 b - - 0 1", true},
+		{"pawns against a rook", "8/5k2/8/1r6/8/5P1K/6P1/8 w - - 0 1", false},
+	}
+	for _, tt := range tests {
+		p := mustParseFEN(t, tt.fen)
+		inCheck := isKingAttacked(p, p.whiteTurn)
+		if res := canTryNullMove(p, nullMoveMinDepth, inCheck); res != tt.expected {
+			t.Errorf("%s: expected %t, got %t", tt.name, tt.expected, res)
+		}
+	}
+
+	p := mustParseFEN(t, tests[0].fen)
+	if canTryNullMove(p, nullMoveMinDepth-1, false) || canTryNullMove(p, nullMoveMinDepth, true) {
+		t.Errorf("expected no null move near the leaves or in check")
+	}
+	p.MakeNullMove()
+	if canTryNullMove(p, nullMoveMinDepth, false) {
+		t.Errorf("expected no second null move in a row")
+	}
+	p.UnmakeNullMove()
+	e, _ := newTestEngine()
+	e.HandleCommand("setoption name NullMovePruning value false")
+	if canTryNullMove(p, nullMoveMinDepth, false) {
+		t.Errorf("expected no null move when the option is off")
+	}
+}
+
+func TestSelectiveSearchReducesNodes(t *testing.T) {
+	setup()
+	defer func() {
+		NullMovePruning, LateMoveReductions, FutilityPruning = true, true, true
+	}()
+
+	options := []*bool{&NullMovePruning, &LateMoveReductions, &FutilityPruning}
+	for _, option := range options {
+		*option = false
+	}
+	fullWidthNodes := searchPerftPositions(t, 5, nil)
+
+	for i, option := range options {
+		*option = true
+		if nodes := searchPerftPositions(t, 5, nil); nodes >= fullWidthNodes {
+			t.Errorf("option %d: expected fewer nodes than %d, got %d", i, fullWidthNodes, nodes)
+		}
+		*option = false
+	}
+}
@@ -0,0 +1,36 @@
+package chess
+
+// pvTable is the triangular table of the principal variation: row ply holds the best line found from that ply,
+// in moves[ply][ply:length[ply]]. A new best move at a ply is followed by the line of the next ply.
+type pvTable struct {
+	length [maxPly]int
+	moves  [maxPly][maxPly]Move
+}
+
+// clear empties the line of the ply, before its position is searched
+func (pv *pvTable) clear(ply int) {
+	if ply < maxPly {
+		pv.length[ply] = ply
+	}
+}
+
+// update makes the move followed by the line of the next ply the best line of the ply
+func (pv *pvTable) update(ply int, move *Move) {
+	if ply >= maxPly-1 {
+		return
+	}
+	pv.moves[ply][ply] = *move
+	next := max(pv.length[ply+1], ply+1)
+	copy(pv.moves[ply][ply+1:next], pv.moves[ply+1][ply+1:next])
+	pv.length[ply] = next
+}
+
+// line returns the principal variation from the root
+func (pv *pvTable) line() []*Move {
+	res := make([]*Move, pv.length[0])
+	for i := range res {
+		move := pv.moves[0][i]
+		res[i] = &move
+	}
+	return res
+}
@@ -0,0 +1,48 @@
+package chess
+
+import (
+	"testing"
+)
+
+func TestPVTable(t *testing.T) {
+	var pv pvTable
+	moves := []Move{
+		newMove(squareIndex(1, 4), squareIndex(3, 4), true, false, 0),
+		newMove(squareIndex(6, 4), squareIndex(4, 4), false, false, 0),
+		newMove(squareIndex(0, 6), squareIndex(2, 5), true, false, 0),
+	}
+
+	// the search backs up from the deepest ply
+	pv.clear(3)
+	pv.update(2, &moves[2])
+	pv.update(1, &moves[1])
+	pv.update(0, &moves[0])
+	if line := pv.line(); len(line) != 3 || !isSameMove(line[0], &moves[0]) || !isSameMove(line[2], &moves[2]) {
+		t.Errorf("unexpected line %v", line)
+	}
+
+	// a better move at ply 1 with an empty line below it cuts the line of ply 0 when it is backed up
+	pv.clear(2)
+	pv.update(1, &moves[2])
+	pv.update(0, &moves[1])
+	if line := pv.line(); len(line) != 2 || !isSameMove(line[0], &moves[1]) || !isSameMove(line[1], &moves[2]) {
+		t.Errorf("unexpected line %v", line)
+	}
+}
+
+func TestPrincipalVariationIsLegal(t *testing.T) {
+	setup()
+
+	searchPerftPositions(t, 4, func(name string, p *Position, line []*Move) {
+		if len(line) < 2 {
+			t.Errorf("%s: expected a principal variation of a few moves, got %v", name, line)
+		}
+
+		for _, move := range line {
+			if !p.IsValidMove(move) {
+				t.Fatalf("%s: %s of the principal variation %v isn't legal", name, move, line)
+			}
+			p.MakeMove(move)
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package chess
+
+import (
+	"sort"
+)
+
+// quiescence resolves the captures and promotions at the horizon of MinimaxTree, so the position isn't
+// evaluated in the middle of an exchange. The side to move may stand pat on the static evaluation instead
+// of capturing, unless it is in check, where all the evasions are searched.
+func (g *Game) quiescence(p *Position, ply int, lowerBoundEval, upperBoundEval Score) Score {
+	if g.timer.checkTime() {
+		return 0
+	}
+	g.selDepth = max(g.selDepth, ply)
+
+	moves := p.GetAllMoves()
+	inCheck := isKingAttacked(p, p.whiteTurn)
+	if len(moves) == 0 && inCheck {
+		return getCheckmateEvaluationAt(p.whiteTurn, ply)
+	}
+	standPat := p.evaluateMoves(moves, &g.noise)
+	if len(moves) == 0 || p.halfmoveClock >= 100 || p.IsInsufficientMaterial() {
+		return standPat
+	}
+
+	// the mobility of the evaluations below compares with all the legal moves, not only the searched ones
+	p.availableMoves = moves
+	bestEval := GetWorstEvaluation(p.whiteTurn)
+	if !inCheck {
+		bestEval = standPat
+		if p.whiteTurn && standPat >= upperBoundEval || !p.whiteTurn && standPat <= lowerBoundEval {
+			return standPat
+		}
+		if p.whiteTurn {
+			lowerBoundEval = max(lowerBoundEval, standPat)
+		} else {
+			upperBoundEval = min(upperBoundEval, standPat)
+		}
+		moves = tacticalMoves(p, moves)
+	}
+
+	for i := range moves {
+		p.MakeMove(&moves[i])
+		eval := g.quiescence(p, ply+1, lowerBoundEval, upperBoundEval)
+		p.UnmakeMove()
+		if g.timer.stopped {
+			return 0
+		}
+
+		if p.whiteTurn && eval > bestEval {
+			bestEval = eval
+			lowerBoundEval = max(lowerBoundEval, eval)
+		}
+		if !p.whiteTurn && eval < bestEval {
+			bestEval = eval
+			upperBoundEval = min(upperBoundEval, eval)
+		}
+		if lowerBoundEval >= upperBoundEval {
+			break
+		}
+	}
+	return bestEval
+}
+
+// tacticalMoves keeps the captures and promotions that don't lose material, most valuable victim and
+// least valuable attacker first
+func tacticalMoves(p *Position, moves []Move) []Move {
+	res := make([]Move, 0, len(moves))
+	for i := range moves {
+		if (moves[i].isCapture || moves[i].pawnPromotePiece != 0) && p.SEE(&moves[i]) >= 0 {
+			res = append(res, moves[i])
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return mvvLva(p, &res[i]) > mvvLva(p, &res[j])
+	})
+	return res
+}
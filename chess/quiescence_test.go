@@ -0,0 +1,72 @@
+package chess
+
+import (
+	"testing"
+)
+
+func TestQuiescenceAvoidsHorizonBlunders(t *testing.T) {
+	setup()
+	defer func() { TreeDepth = 2 }()
+
+	tests := []struct {
+		name        string
+		fen         string
+		depth       int
+		notExpected string
+	}{
+		{"white queen takes a pawn defended by a pawn", "4k3/8/2p5/3p4/8/8/3Q4/4K3 w - - 0 1", 1, "d2d5"},
+		{"black queen takes a pawn defended by a pawn", "4k3/3q4/8/8/3P4/2P5/8/4K3 b - - 0 1", 1, "d7d4"},
+		{"rook takes a knight defended twice", "4k3/8/1p3p2/2p1p3/3n4/8/8/3RK3 w - - 0 1", 1, "d1d4"},
+	}
+
+	for _, tt := range tests {
+		TreeDepth = tt.depth
+		e, _ := newTestEngine()
+		e.HandleCommand("ucinewgame")
+		e.HandleCommand("position fen " + tt.fen)
+		e.HandleCommand("go")
+		e.waitSearch()
+		if move := moveToUCI(*e.game.GetLastMove()); move == tt.notExpected {
+			t.Errorf("%s: didn't expect %s", tt.name, move)
+		}
+	}
+}
+
+func TestQuiescenceScore(t *testing.T) {
+	setup()
+	game := NewGame()
+	game.timer = newTimeManager(TimeControl{}, true)
+
+	tests := []struct {
+		name     string
+		fen      string
+		min, max Score
+	}{
+		// the black queen hangs to a pawn
+		{"winning capture", "4k3/8/8/3q4/4P3/8/8/4K3 w - - 0 1", 50, 200},
+		// taking the pawn on d5 loses the queen, so white stands pat
+		{"losing capture", "4k3/8/2p5/3p4/8/8/3Q4/4K3 w - - 0 1", 500, 800},
+		{"checkmate", "4k3/4Q3/4K3/8/8/8/8/8 b - - 0 1", CheckmateEvaluation, CheckmateEvaluation},
+	}
+	for _, tt := range tests {
+		p := mustParseFEN(t, tt.fen)
+		p.hash = ComputeZobristHash(p)
+		if eval := game.quiescence(p, 0, LowestPositionScore, HighestPositionScore); eval < tt.min || eval > tt.max {
+			t.Errorf("%s: expected an evaluation between %d and %d, got %d", tt.name, tt.min, tt.max, eval)
+		}
+	}
+}
+
+func TestQuiescenceMobility(t *testing.T) {
+	setup()
+	game := NewGame()
+	game.timer = newTimeManager(TimeControl{}, true)
+
+	// the positions below the captures measure their mobility against all the moves, like after the main search
+	p := mustParseFEN(t, "4k3/8/8/3q4/4P3/8/8/4K3 w - - 0 1")
+	p.hash = ComputeZobristHash(p)
+	game.quiescence(p, 0, LowestPositionScore, HighestPositionScore)
+	if moves := p.GetAllMoves(); len(p.availableMoves) != len(moves) {
+		t.Errorf("expected the %d legal moves for the mobility, got %d", len(moves), len(p.availableMoves))
+	}
+}
@@ -0,0 +1,64 @@
+package chess
+
+// repetitionHistory is the stack of the hashes of the positions reached in the game, followed by the
+// positions of the current search line. The last entry is the current position.
+type repetitionHistory struct {
+	hashes []uint64
+	// index of the search root in hashes
+	rootPly int
+}
+
+func (h *repetitionHistory) reset(hash uint64) {
+	h.hashes = append(h.hashes[:0], hash)
+	h.rootPly = 0
+}
+
+func (h *repetitionHistory) push(hash uint64) {
+	h.hashes = append(h.hashes, hash)
+}
+
+func (h *repetitionHistory) pop() {
+	h.hashes = h.hashes[:len(h.hashes)-1]
+}
+
+// startSearch marks the current position as the search root
+func (h *repetitionHistory) startSearch() {
+	h.rootPly = len(h.hashes) - 1
+}
+
+// ply is the distance of the current position from the search root
+func (h *repetitionHistory) ply() int {
+	return len(h.hashes) - 1 - h.rootPly
+}
+
+// occurrences counts how many times the current position occurred before, and whether one of them is in the
+// current search line. Positions before the last irreversible move can't repeat, so only the last halfmoveClock
+// plies are scanned, and only every second one of them has the same side to move.
+func (h *repetitionHistory) occurrences(halfmoveClock int) (int, bool) {
+	count := 0
+	inSearch := false
+	last := len(h.hashes) - 1
+	for i := last - 2; i >= 0 && i >= last-halfmoveClock; i -= 2 {
+		if h.hashes[i] == h.hashes[last] {
+			count++
+			if i >= h.rootPly {
+				inSearch = true
+			}
+		}
+	}
+	return count, inSearch
+}
+
+// isThreeFoldRepetition checks whether the current position occurred twice before
+func (h *repetitionHistory) isThreeFoldRepetition(halfmoveClock int) bool {
+	count, _ := h.occurrences(halfmoveClock)
+	return count >= 2
+}
+
+// isSearchDraw checks whether the search should score the current position as a draw: repeating a position
+// of the current search line is enough, since the line could be repeated again, while positions played
+// before the search must have occurred twice
+func (h *repetitionHistory) isSearchDraw(halfmoveClock int) bool {
+	count, inSearch := h.occurrences(halfmoveClock)
+	return inSearch || count >= 2
+}
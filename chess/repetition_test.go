@@ -0,0 +1,32 @@
+package chess
+
+import (
+	"testing"
+)
+
+func TestRepetitionHistory(t *testing.T) {
+	tests := []struct {
+		name          string
+		hashes        []uint64
+		rootPly       int
+		halfmoveClock int
+		threeFold     bool
+		searchDraw    bool
+	}{
+		{"no repetition", []uint64{1, 2, 3, 4, 5}, 0, 4, false, false},
+		{"twofold before the search", []uint64{1, 2, 3, 4, 1}, 3, 4, false, false},
+		{"twofold in the search", []uint64{1, 2, 3, 4, 1}, 0, 4, false, true},
+		{"threefold before the search", []uint64{1, 2, 1, 2, 1}, 4, 4, true, true},
+		{"repetition before an irreversible move", []uint64{1, 2, 3, 4, 1}, 0, 2, false, false},
+		{"other side to move", []uint64{1, 2, 3, 1}, 0, 3, false, false},
+	}
+	for _, tt := range tests {
+		h := repetitionHistory{hashes: tt.hashes, rootPly: tt.rootPly}
+		if h.isThreeFoldRepetition(tt.halfmoveClock) != tt.threeFold {
+			t.Errorf("%s: isThreeFoldRepetition should be %t", tt.name, tt.threeFold)
+		}
+		if h.isSearchDraw(tt.halfmoveClock) != tt.searchDraw {
+			t.Errorf("%s: isSearchDraw should be %t", tt.name, tt.searchDraw)
+		}
+	}
+}
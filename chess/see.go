@@ -0,0 +1,84 @@
+package chess
+
+// seeKingValue makes the king the last piece to capture with, it can only recapture when the square is not defended
+const seeKingValue = 100 * PawnScore
+
+func seeValue(piece uint8) Score {
+	if piece == KingBit {
+		return seeKingValue
+	}
+	return pieceCost[piece]
+}
+
+// attackersTo returns the pieces of both colors that attack the square, with the sliding pieces blocked by occupied
+func (p *Position) attackersTo(sq uint8, occupied uint64) uint64 {
+	pawns := p.pieces[pieceIndex(PawnBit)]
+	queens := p.pieces[pieceIndex(QueenBit)]
+
+	// a pawn of one color stands where a pawn of the other color on sq would attack
+	attackers := pawnAttacks[colorIndex(false)][sq] & pawns & p.colors[colorIndex(true)]
+	attackers |= pawnAttacks[colorIndex(true)][sq] & pawns & p.colors[colorIndex(false)]
+	attackers |= knightAttacks[sq] & p.pieces[pieceIndex(KnightBit)]
+	attackers |= kingAttacks[sq] & p.pieces[pieceIndex(KingBit)]
+	attackers |= bishopAttacks(sq, occupied) & (p.pieces[pieceIndex(BishopBit)] | queens)
+	attackers |= rookAttacks(sq, occupied) & (p.pieces[pieceIndex(RookBit)] | queens)
+	return attackers & occupied
+}
+
+// SEE returns the material the side to move wins with the move, in centipawns, when both sides keep
+// capturing on the target square with their least valuable piece for as long as it pays off.
+// Pieces behind the capturing ones join the exchange (x-rays), pins are not considered.
+func (p *Position) SEE(move *Move) Score {
+	to := squareIndex(move.toRow, move.toCol)
+	occupied := p.occupied() &^ squareBit(move.fromRow, move.fromCol)
+
+	attacker, _ := getPiece(move.fromRow, move.fromCol, p)
+	victim, _ := getPiece(move.toRow, move.toCol, p)
+	if move.isEnPassant {
+		victim = PawnBit
+		occupied &^= squareBit(move.fromRow, move.toCol)
+	}
+
+	// gains[i] is the material won by the side making the i-th capture, if the exchange stops after it
+	gains := make([]Score, 1, 32)
+	gains[0] = seeValue(victim)
+	onSquare := seeValue(attacker)
+	if move.pawnPromotePiece != 0 {
+		promoted := seeValue(move.pawnPromotePiece & ^isWhiteBit)
+		gains[0] += promoted - seeValue(PawnBit)
+		onSquare = promoted
+	}
+
+	side := !move.isWhite
+	for {
+		attackers := p.attackersTo(to, occupied)
+		own := attackers & p.colors[colorIndex(side)]
+		if own == 0 {
+			break
+		}
+		sq, piece := p.leastValuableAttacker(own)
+		if piece == KingBit && attackers&p.colors[colorIndex(!side)] != 0 {
+			break
+		}
+
+		gains = append(gains, onSquare-gains[len(gains)-1])
+		onSquare = seeValue(piece)
+		occupied &^= uint64(1) << sq
+		side = !side
+	}
+
+	// every side may stop capturing when continuing loses material
+	for i := len(gains) - 1; i > 0; i-- {
+		gains[i-1] = -max(-gains[i-1], gains[i])
+	}
+	return gains[0]
+}
+
+func (p *Position) leastValuableAttacker(attackers uint64) (uint8, uint8) {
+	for piece := PawnBit; piece <= KingBit; piece <<= 1 {
+		if bb := attackers & p.pieces[pieceIndex(piece)]; bb != 0 {
+			return popLSB(&bb), piece
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,35 @@
+package chess
+
+import (
+	"testing"
+)
+
+func TestSEE(t *testing.T) {
+	tests := []struct {
+		name     string
+		fen      string
+		move     string
+		expected Score
+	}{
+		{"undefended pawn", "1k1r4/1pp4p/p7/4p3/8/P5P1/1PP4P/2K1R3 w - - 0 1", "e1e5", 100},
+		{"pawn takes pawn", "4k3/8/8/3p4/4P3/8/8/4K3 w - - 0 1", "e4d5", 100},
+		{"queen takes a pawn defended by a pawn", "4k3/8/2p5/3p4/8/8/3Q4/4K3 w - - 0 1", "d2d5", -800},
+		// the rook and the queen behind the first attackers join the exchange
+		{"x-rays", "1k1r3q/1ppn3p/p4b2/4p3/8/P2N2P1/1PP1R1BP/2K1Q3 w - - 0 1", "d3e5", -200},
+		{"doubled rooks", "4k3/3r4/3r4/8/8/8/3R4/3RK3 w - - 0 1", "d2d6", 500},
+		{"king can't recapture a defended piece", "3k4/3p4/8/8/8/8/3Q4/3RK3 w - - 0 1", "d2d7", 100},
+		{"king recaptures", "3k4/3p4/8/8/8/8/3Q4/4K3 w - - 0 1", "d2d7", -800},
+		{"en passant", "4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", 100},
+		{"capture with promotion", "2r5/1P1k4/8/8/8/8/8/4K3 w - - 0 1", "b7c8q", 400},
+		{"black exchange", "4k3/8/8/4p3/3P4/2P5/8/4K3 b - - 0 1", "e5d4", 0},
+		{"quiet move to an attacked square", "4k3/8/8/4p3/8/8/8/3QK3 w - - 0 1", "d1d4", -900},
+	}
+
+	for _, tt := range tests {
+		p := mustParseFEN(t, tt.fen)
+		move := parseMove(tt.move, p)
+		if see := p.SEE(&move); see != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, see)
+		}
+	}
+}
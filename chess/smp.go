@@ -0,0 +1,57 @@
+package chess
+
+import (
+	"math/rand"
+	"slices"
+	"sync"
+)
+
+// The search is a Lazy SMP: helper threads search the same root position as the main thread, and share what
+// they find only through the transposition table. Their killers, history and principal variation are their own.
+// Every second helper starts one ply deeper, and the random part of the evaluation of every helper differs,
+// so the threads fill the table with different parts of the tree instead of repeating each other.
+// The move is the one of the main thread, which reports the search, the helpers only make it faster.
+
+// helperThreads are the helpers of a search of the main thread
+type helperThreads struct {
+	wg    sync.WaitGroup
+	games []*Game
+}
+
+// startHelpers starts a helper for every thread beyond the first, they search until the main thread stops them
+func (g *Game) startHelpers(treeDepth int) *helperThreads {
+	h := &helperThreads{}
+	for id := 1; id < g.threads; id++ {
+		h.games = append(h.games, g.newHelper(id))
+	}
+	for _, helper := range h.games {
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			helper.iterativeDeepening(treeDepth, 1+helper.threadID%2)
+		}()
+	}
+	return h
+}
+
+// stop aborts the helpers once the main thread is done, and waits for them
+func (h *helperThreads) stop(g *Game) {
+	g.timer.abort.Store(true)
+	h.wg.Wait()
+}
+
+// newHelper copies what a helper needs of the game to search its position
+func (g *Game) newHelper(id int) *Game {
+	helper := &Game{
+		position:  ClonePosition(g.position),
+		treeDepth: g.treeDepth,
+		limits:    g.limits,
+		threads:   1,
+		threadID:  id,
+		seed:      g.seed + int64(id),
+		timer:     timeManager{start: g.timer.start, abort: g.timer.abort, searchNodes: g.timer.searchNodes},
+		history:   repetitionHistory{hashes: slices.Clone(g.history.hashes), rootPly: g.history.rootPly},
+	}
+	helper.noise = evaluationNoise{rand: rand.New(rand.NewSource(helper.seed)), max: g.noise.max}
+	return helper
+}
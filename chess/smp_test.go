@@ -0,0 +1,46 @@
+package chess
+
+import (
+	"testing"
+)
+
+func TestLazySMP(t *testing.T) {
+	setup()
+	e, out := newTestEngine()
+	e.HandleCommand("setoption name Threads value 4")
+	e.HandleCommand("ucinewgame")
+	e.HandleCommand("position startpos moves e2e4 e7e5 f1c4 f8c5 d1h5 g8f6")
+	e.HandleCommand("go")
+	e.waitSearch()
+	if lastCommand := bestMove(out); lastCommand != "h5f7" {
+		t.Errorf("The threads didn't find a mate in 1, got %s", lastCommand)
+	}
+
+	e.HandleCommand("position fen r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	e.HandleCommand("go movetime 300")
+	e.waitSearch()
+	move := e.game.GetLastMove()
+	if move == nil || !e.game.initPosition.IsValidMove(move) {
+		t.Errorf("expected a legal move, got %v", move)
+	}
+}
+
+func TestNewHelper(t *testing.T) {
+	p := mustParseFEN(t, "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	game := new(Game)
+	game.InitGameFromPosition(p, 4)
+	game.timer = newTimeManager(TimeControl{}, true)
+
+	helper := game.newHelper(1)
+	if helper.position == game.position || helper.position.hash != game.position.hash {
+		t.Errorf("expected a copy of the position")
+	}
+	helper.history.push(1)
+	if len(game.history.hashes) != 1 {
+		t.Errorf("expected the helper to have its own repetition history")
+	}
+	helper.timer.abort.Store(true)
+	if !game.timer.abort.Load() {
+		t.Errorf("expected the helper to share the abort flag")
+	}
+}
@@ -0,0 +1,178 @@
+package chess
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// maxSearchDepth bounds iterative deepening when the search is limited by time only
+const maxSearchDepth = 64
+
+// moveOverhead is kept in reserve on every move for the communication with the GUI
+const moveOverhead = 30 * time.Millisecond
+
+// defaultMovesToGo is the number of moves the remaining time is split over when the GUI doesn't send movestogo
+const defaultMovesToGo = 30
+
+// checkTimeNodes is how often, in nodes, the search checks the clock
+const checkTimeNodes = 256
+
+// TimeControl holds the clock parameters of the go command, zero values mean not set
+type TimeControl struct {
+	WhiteTime time.Duration
+	BlackTime time.Duration
+	WhiteInc  time.Duration
+	BlackInc  time.Duration
+	MovesToGo int
+	MoveTime  time.Duration
+}
+
+func (tc TimeControl) isLimited() bool {
+	return tc.MoveTime > 0 || tc.WhiteTime > 0 || tc.BlackTime > 0
+}
+
+// SearchLimits holds the limits of the go command, zero values mean not set. The search stops at the first
+// limit it reaches, an infinite search only once the GUI stops it. The time limits let the first iteration
+// complete, the nodes limit stops it too once a root move has a score. A ponder search ignores the time limits
+// until the ponderhit command.
+type SearchLimits struct {
+	TimeControl
+	Depth int
+	Nodes uint64
+	// Mate is the number of moves of the checkmate to search for
+	Mate     int
+	Infinite bool
+	Ponder   bool
+	// SearchMoves restricts the search to these root moves
+	SearchMoves []Move
+}
+
+// maxDepth is the depth the iterations go to, treeDepth when the go command doesn't limit the search
+func (l SearchLimits) maxDepth(treeDepth int) int {
+	if l.Depth > 0 {
+		return min(l.Depth, maxSearchDepth)
+	}
+	if l.Infinite || l.Ponder || l.Nodes > 0 || l.Mate > 0 || l.isLimited() {
+		return maxSearchDepth
+	}
+	return treeDepth
+}
+
+// foundMate tells if eval is a checkmate by the side to move within the moves of the mate limit
+func (l SearchLimits) foundMate(eval Score, whiteTurn bool) bool {
+	return l.Mate > 0 && IsCheckmateEvaluation(eval) && sideEval(eval, whiteTurn) > 0 && (checkmatePlies(eval)+1)/2 <= l.Mate
+}
+
+// timeManager decides when the search stops. No new iteration starts after half of the optimum time,
+// since the next one takes longer than all the previous ones, and an iteration is aborted at the maximum time.
+type timeManager struct {
+	start   time.Time
+	optimum time.Duration
+	maximum time.Duration
+	limited bool
+
+	nodes uint64
+	// maxNodes stops the search once all the threads searched that many nodes, 0 = no limit
+	maxNodes uint64
+	// searchNodes counts the nodes of all the threads of a search, every thread adds its nodes
+	// in batches of checkTimeNodes
+	searchNodes *atomic.Uint64
+	// canStop is false during the first iteration, which always completes unless the nodes limit stops it
+	// once rootScored, when the first root move has a score
+	canStop    bool
+	rootScored bool
+	stopped    bool
+	// abort is shared by the threads of a search, it stops the helpers once the main thread is done
+	abort *atomic.Bool
+	// ponderhit is closed once the GUI sends ponderhit, the time limits don't apply before, nil = not pondering
+	ponderhit <-chan struct{}
+}
+
+func newTimeManager(tc TimeControl, whiteTurn bool) timeManager {
+	tm := timeManager{start: time.Now(), limited: tc.isLimited(), abort: new(atomic.Bool), searchNodes: new(atomic.Uint64)}
+	if !tm.limited {
+		return tm
+	}
+
+	if tc.MoveTime > 0 {
+		tm.optimum = max(tc.MoveTime-moveOverhead, time.Millisecond)
+		tm.maximum = tm.optimum
+		return tm
+	}
+
+	remaining, inc := tc.BlackTime, tc.BlackInc
+	if whiteTurn {
+		remaining, inc = tc.WhiteTime, tc.WhiteInc
+	}
+	movesToGo := tc.MovesToGo
+	if movesToGo <= 0 {
+		movesToGo = defaultMovesToGo
+	}
+
+	// never plan to use more than what is left on the clock
+	available := max(remaining-moveOverhead, time.Millisecond)
+	tm.optimum = min(remaining/time.Duration(movesToGo)+inc*3/4, available)
+	tm.maximum = min(tm.optimum*4, available/2+inc/2, available)
+	tm.optimum = min(tm.optimum, tm.maximum)
+	return tm
+}
+
+// totalNodes returns the nodes all the threads searched so far, the batches of the other threads
+// that aren't complete yet aside
+func (tm *timeManager) totalNodes() uint64 {
+	if tm.searchNodes == nil {
+		return tm.nodes
+	}
+	return tm.searchNodes.Load() + tm.nodes%checkTimeNodes
+}
+
+func (tm *timeManager) elapsed() time.Duration {
+	return time.Since(tm.start)
+}
+
+// pondering tells if the search thinks on the time of the opponent, as long as the GUI didn't send ponderhit
+func (tm *timeManager) pondering() bool {
+	if tm.ponderhit == nil {
+		return false
+	}
+	select {
+	case <-tm.ponderhit:
+		return false
+	default:
+		return true
+	}
+}
+
+// outOfTime tells if the maximum time passed, the time spent pondering counts after ponderhit
+func (tm *timeManager) outOfTime() bool {
+	return tm.limited && !tm.pondering() && tm.elapsed() >= tm.maximum
+}
+
+// outOfNodes tells if the threads searched the nodes of the nodes limit
+func (tm *timeManager) outOfNodes() bool {
+	return tm.maxNodes > 0 && tm.totalNodes() >= tm.maxNodes
+}
+
+// canStartIteration tells if there is enough time and nodes left to search one ply deeper
+func (tm *timeManager) canStartIteration() bool {
+	if tm.abort != nil && tm.abort.Load() || tm.outOfNodes() {
+		return false
+	}
+	return !tm.limited || tm.pondering() || tm.elapsed() < tm.optimum/2
+}
+
+// checkTime is called on every node and marks the search stopped once the maximum time passed,
+// the nodes limit is reached or the search is aborted
+func (tm *timeManager) checkTime() bool {
+	tm.nodes++
+	if tm.nodes%checkTimeNodes != 0 {
+		return tm.stopped
+	}
+	if tm.searchNodes != nil {
+		tm.searchNodes.Add(checkTimeNodes)
+	}
+	if tm.outOfNodes() && (tm.canStop || tm.rootScored) || tm.canStop && (tm.outOfTime() || tm.abort != nil && tm.abort.Load()) {
+		tm.stopped = true
+	}
+	return tm.stopped
+}
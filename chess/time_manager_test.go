@@ -0,0 +1,167 @@
+package chess
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSearchLimits(t *testing.T) {
+	limits := parseSearchLimits(strings.Fields("go wtime 60000 btime 30000 winc 1000 binc 500 movestogo 12"), NewGame().position)
+	expected := TimeControl{
+		WhiteTime: time.Minute,
+		BlackTime: 30 * time.Second,
+		WhiteInc:  time.Second,
+		BlackInc:  500 * time.Millisecond,
+		MovesToGo: 12,
+	}
+	if limits.TimeControl != expected {
+		t.Errorf("expected %+v, got %+v", expected, limits.TimeControl)
+	}
+
+	limits = parseSearchLimits(strings.Fields("go searchmoves e2e4 e2e5 g1f3 depth 5 nodes 10000 mate 3 movetime 200 infinite"), NewGame().position)
+	if limits.Depth != 5 || limits.Nodes != 10000 || limits.Mate != 3 || limits.MoveTime != 200*time.Millisecond || !limits.Infinite {
+		t.Errorf("unexpected limits %+v", limits)
+	}
+	var searchMoves []string
+	for _, move := range limits.SearchMoves {
+		searchMoves = append(searchMoves, moveToUCI(move))
+	}
+	if strings.Join(searchMoves, " ") != "e2e4 g1f3" {
+		t.Errorf("expected the legal searchmoves e2e4 g1f3, got %v", searchMoves)
+	}
+
+	if limits := parseSearchLimits(strings.Fields("go ponder wtime 1000 btime 1000"), NewGame().position); !limits.Ponder || limits.WhiteTime != time.Second {
+		t.Errorf("expected a ponder search with the clocks, got %+v", limits)
+	}
+	if limits := parseSearchLimits(strings.Fields("go infinite"), NewGame().position); limits.isLimited() || limits.maxDepth(2) != maxSearchDepth {
+		t.Errorf("go infinite shouldn't be limited: %+v", limits)
+	}
+	if limits := parseSearchLimits(strings.Fields("go"), NewGame().position); limits.maxDepth(2) != 2 {
+		t.Errorf("go should search to the Depth option, got %d", limits.maxDepth(2))
+	}
+}
+
+func TestTimeAllocation(t *testing.T) {
+	tests := []struct {
+		name    string
+		tc      TimeControl
+		white   bool
+		optimum time.Duration
+		maximum time.Duration
+	}{
+		{"movetime", TimeControl{MoveTime: time.Second}, true, time.Second - moveOverhead, time.Second - moveOverhead},
+		{"sudden death", TimeControl{WhiteTime: 30 * time.Second, BlackTime: time.Second}, true, time.Second, 4 * time.Second},
+		{"black clock", TimeControl{WhiteTime: 30 * time.Second, BlackTime: 60 * time.Second, BlackInc: time.Second}, false,
+			2*time.Second + 750*time.Millisecond, 11 * time.Second},
+		{"last move before the time control", TimeControl{WhiteTime: 10 * time.Second, MovesToGo: 1}, true,
+			5*time.Second - moveOverhead/2, 5*time.Second - moveOverhead/2},
+		{"no time left", TimeControl{WhiteTime: 10 * time.Millisecond}, true, 10 * time.Millisecond / defaultMovesToGo, time.Millisecond / 2},
+	}
+
+	for _, tt := range tests {
+		tm := newTimeManager(tt.tc, tt.white)
+		if !tm.limited || tm.optimum != tt.optimum || tm.maximum != tt.maximum {
+			t.Errorf("%s: expected optimum %v and maximum %v, got %v and %v", tt.name, tt.optimum, tt.maximum, tm.optimum, tm.maximum)
+		}
+	}
+}
+
+func TestSearchStopsOnTime(t *testing.T) {
+	setup()
+
+	e, _ := newTestEngine()
+	e.HandleCommand("ucinewgame")
+	e.HandleCommand("position fen r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3")
+
+	start := time.Now()
+	e.HandleCommand("go movetime 300")
+	e.waitSearch()
+	if took := time.Since(start); took > 600*time.Millisecond {
+		t.Errorf("go movetime 300 took %v", took)
+	}
+	if e.game.GetLastMove() == nil {
+		t.Fatalf("expected a move")
+	}
+
+	// even without time, the first iteration completes and gives a legal move
+	e.HandleCommand("position startpos")
+	e.HandleCommand("go wtime 1 btime 1")
+	e.waitSearch()
+	move := e.game.GetLastMove()
+	if move == nil || !e.game.initPosition.IsValidMove(move) {
+		t.Errorf("expected a legal move, got %v", move)
+	}
+}
+
+func TestSearchLimits(t *testing.T) {
+	setup()
+
+	e, out := newTestEngine()
+	e.HandleCommand("setoption name Randomness value 0")
+	e.HandleCommand("position startpos moves e2e4 e7e5")
+	e.HandleCommand("go depth 3")
+	e.waitSearch()
+	if lines := outputLines(out); !strings.HasPrefix(lines[len(lines)-2], "info depth 3 ") {
+		t.Errorf("expected the search to end at depth 3, got %q", lines[len(lines)-2])
+	}
+
+	// the same nodes limit gives the same search
+	var bestMoves []string
+	for range 2 {
+		e.HandleCommand("ucinewgame")
+		e.HandleCommand("position startpos moves e2e4 e7e5")
+		e.HandleCommand("go nodes 20000")
+		e.waitSearch()
+		if nodes := e.game.timer.totalNodes(); nodes < 20000 || nodes >= 20000+checkTimeNodes {
+			t.Errorf("expected the search to stop after 20000 nodes, got %d", nodes)
+		}
+		bestMoves = append(bestMoves, lastLine(out))
+	}
+	if bestMoves[0] != bestMoves[1] {
+		t.Errorf("expected the same move with the same nodes, got %v", bestMoves)
+	}
+
+	// a small nodes limit stops the first iteration too, after its first root move
+	e.HandleCommand("ucinewgame")
+	e.HandleCommand("position fen r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	e.HandleCommand("go nodes 1")
+	e.waitSearch()
+	if nodes := e.game.timer.totalNodes(); nodes > checkTimeNodes || bestMove(out) == "0000" {
+		t.Errorf("expected a move after %d nodes, got %s after %d", checkTimeNodes, lastLine(out), nodes)
+	}
+
+	e.HandleCommand("position startpos")
+	e.HandleCommand("go depth 3 searchmoves a2a3 h2h3")
+	e.waitSearch()
+	if move := bestMove(out); move != "a2a3" && move != "h2h3" {
+		t.Errorf("expected one of the searchmoves, got %s", move)
+	}
+
+	// the search stops once it finds a mate within 2 moves
+	e.HandleCommand("position fen 6k1/5ppp/8/8/8/8/5PPP/R2R2K1 w - - 0 1")
+	e.HandleCommand("go mate 2")
+	e.waitSearch()
+	lines := outputLines(out)
+	if !strings.Contains(lines[len(lines)-2], " score mate ") || bestMove(out) == "0000" {
+		t.Errorf("expected a mate, got %q and %q", lines[len(lines)-2], lastLine(out))
+	}
+}
+
+func TestInfiniteSearchWaitsForStop(t *testing.T) {
+	setup()
+
+	e, out := newTestEngine()
+	e.HandleCommand("position fen 6k1/5ppp/8/8/8/8/5PPP/3R2K1 w - - 0 1")
+	e.HandleCommand("go infinite")
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case <-e.done:
+		t.Fatalf("an infinite search shouldn't send its bestmove before stop")
+	default:
+	}
+	e.HandleCommand("stop")
+	if bestMove(out) != "d1d8" {
+		t.Errorf("expected bestmove d1d8, got %s", lastLine(out))
+	}
+}
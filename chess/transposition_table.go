@@ -0,0 +1,180 @@
+package chess
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// DefaultHashSizeMB is the default size of the transposition table, set by the UCI Hash option
+const DefaultHashSizeMB = 16
+
+// ttLocks is the number of locks the entries are striped over, for the threads of the search to share the table
+const ttLocks = 1024
+
+// bound tells how the score of a transposition table entry relates to the real evaluation, for white
+type bound uint8
+
+const (
+	boundNone bound = iota
+	// boundExact is a score within the alpha-beta window
+	boundExact
+	// boundLower is a score of a fail high, the real evaluation is at least the score
+	boundLower
+	// boundUpper is a score of a fail low, the real evaluation is at most the score
+	boundUpper
+)
+
+type ttEntry struct {
+	key        uint64
+	move       Move
+	score      Score
+	depth      int8
+	bound      bound
+	generation uint8
+}
+
+// TranspositionTable caches search results by the zobrist hash of the position.
+// It has a power of two number of entries, one per slot. Probing and storing are safe for concurrent use.
+type TranspositionTable struct {
+	entries []ttEntry
+	mask    uint64
+	locks   [ttLocks]sync.Mutex
+	// generation is increased on every search, to replace the entries of older searches first
+	generation uint8
+}
+
+var transpositionTable *TranspositionTable
+
+func NewTranspositionTable(sizeMB int) *TranspositionTable {
+	count := uint64(max(sizeMB, 1)) << 20 / uint64(unsafe.Sizeof(ttEntry{}))
+	// round down to a power of two
+	for count&(count-1) != 0 {
+		count &= count - 1
+	}
+	return &TranspositionTable{
+		entries: make([]ttEntry, count),
+		mask:    count - 1,
+	}
+}
+
+func (tt *TranspositionTable) Clear() {
+	clear(tt.entries)
+	tt.generation = 0
+}
+
+func (tt *TranspositionTable) newSearch() {
+	tt.generation++
+}
+
+func (tt *TranspositionTable) lock(index uint64) *sync.Mutex {
+	return &tt.locks[index%ttLocks]
+}
+
+func (tt *TranspositionTable) probe(key uint64) (ttEntry, bool) {
+	index := key & tt.mask
+	lock := tt.lock(index)
+	lock.Lock()
+	entry := tt.entries[index]
+	lock.Unlock()
+	return entry, entry.bound != boundNone && entry.key == key
+}
+
+// store keeps the entry unless the slot holds a deeper search of another position from the current search
+func (tt *TranspositionTable) store(key uint64, depth int, b bound, score Score, move *Move) {
+	index := key & tt.mask
+	lock := tt.lock(index)
+	lock.Lock()
+	defer lock.Unlock()
+
+	entry := &tt.entries[index]
+	if entry.key != key && entry.generation == tt.generation && int(entry.depth) > depth {
+		return
+	}
+
+	newEntry := ttEntry{
+		key:        key,
+		score:      score,
+		depth:      int8(depth),
+		bound:      b,
+		generation: tt.generation,
+	}
+	if move != nil {
+		newEntry.move = *move
+	} else if entry.key == key {
+		// keep the best move of the previous search of the position
+		newEntry.move = entry.move
+	}
+	*entry = newEntry
+}
+
+// hashFull returns the permille of the entries used by the current search
+func (tt *TranspositionTable) hashFull() int {
+	used := 0
+	for i := 0; i < 1000 && i < len(tt.entries); i++ {
+		entry, _ := tt.probe(uint64(i))
+		if entry.bound != boundNone && entry.generation == tt.generation {
+			used++
+		}
+	}
+	return used * 1000 / min(1000, len(tt.entries))
+}
+
+// hasMove tells if the entry has a best move, an empty move goes from a1 to a1
+func (e *ttEntry) hasMove() bool {
+	return e.move.fromRow != e.move.toRow || e.move.fromCol != e.move.toCol
+}
+
+// cutoff returns the score of the entry, probed ply plies from the root, when it decides the evaluation
+// of the alpha-beta window
+func (e *ttEntry) cutoff(depth int, ply int, lowerBoundEval, upperBoundEval Score) (Score, bool) {
+	if int(e.depth) < depth {
+		return 0, false
+	}
+	score := fromTTScore(e.score, ply)
+	switch {
+	case e.bound == boundExact,
+		e.bound == boundLower && score >= upperBoundEval,
+		e.bound == boundUpper && score <= lowerBoundEval:
+		return score, true
+	}
+	return 0, false
+}
+
+// toTTScore makes the distance of a checkmate score relative to the position instead of the root,
+// as the position can be reached at another ply
+func toTTScore(score Score, ply int) Score {
+	if IsCheckmateEvaluation(score) {
+		return score + Score(ply)*sign(score)
+	}
+	return score
+}
+
+// fromTTScore makes the distance of a checkmate score of the table relative to the root again
+func fromTTScore(score Score, ply int) Score {
+	if IsCheckmateEvaluation(score) {
+		return score - Score(ply)*sign(score)
+	}
+	return score
+}
+
+func sign(score Score) Score {
+	if score < 0 {
+		return -1
+	}
+	return 1
+}
+
+func scoreBound(eval, lowerBoundEval, upperBoundEval Score) bound {
+	if eval <= lowerBoundEval {
+		return boundUpper
+	}
+	if eval >= upperBoundEval {
+		return boundLower
+	}
+	return boundExact
+}
+
+func isSameMove(a, b *Move) bool {
+	return a.fromRow == b.fromRow && a.fromCol == b.fromCol && a.toRow == b.toRow && a.toCol == b.toCol &&
+		a.pawnPromotePiece == b.pawnPromotePiece
+}
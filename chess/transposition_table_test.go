@@ -0,0 +1,88 @@
+package chess
+
+import (
+	"testing"
+)
+
+func TestTranspositionTable(t *testing.T) {
+	tt := NewTranspositionTable(1)
+	if len(tt.entries)&(len(tt.entries)-1) != 0 {
+		t.Fatalf("expected a power of two number of entries, got %d", len(tt.entries))
+	}
+
+	move := newMove(squareIndex(1, 4), squareIndex(3, 4), true, false, 0)
+	key := uint64(0x1234)
+	if _, found := tt.probe(key); found {
+		t.Errorf("expected an empty table")
+	}
+
+	tt.store(key, 3, boundExact, 50, &move)
+	entry, found := tt.probe(key)
+	if !found || entry.score != 50 || entry.depth != 3 || !entry.hasMove() || !isSameMove(&entry.move, &move) {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+	if _, ok := entry.cutoff(4, 0, -100, 100); ok {
+		t.Errorf("a shallower entry shouldn't cut off a deeper search")
+	}
+	if score, ok := entry.cutoff(3, 0, -100, 100); !ok || score != 50 {
+		t.Errorf("expected an exact cutoff")
+	}
+
+	// another position in the same slot doesn't replace a deeper entry of the current search
+	otherKey := key + uint64(len(tt.entries))
+	tt.store(otherKey, 2, boundLower, 100, nil)
+	if _, found := tt.probe(otherKey); found {
+		t.Errorf("a shallower entry replaced a deeper one")
+	}
+	// but does replace the entries of older searches
+	tt.newSearch()
+	tt.store(otherKey, 2, boundLower, 100, nil)
+	entry, found = tt.probe(otherKey)
+	if !found || entry.hasMove() {
+		t.Errorf("expected the entry of the older search to be replaced, got %+v", entry)
+	}
+	if _, ok := entry.cutoff(2, 0, -100, 50); !ok {
+		t.Errorf("expected a lower bound above beta to cut off")
+	}
+	if _, ok := entry.cutoff(2, 0, -100, 200); ok {
+		t.Errorf("a lower bound below beta shouldn't cut off")
+	}
+
+	// the same position keeps its best move when it is searched again without one
+	tt.store(otherKey, 1, boundUpper, -100, &move)
+	tt.store(otherKey, 1, boundUpper, -200, nil)
+	if entry, _ = tt.probe(otherKey); !isSameMove(&entry.move, &move) || entry.score != -200 {
+		t.Errorf("expected the best move to be kept, got %+v", entry)
+	}
+
+	tt.Clear()
+	if _, found := tt.probe(otherKey); found || tt.hashFull() != 0 {
+		t.Errorf("expected the table to be cleared")
+	}
+}
+
+func TestTranspositionTableReducesSearch(t *testing.T) {
+	setup()
+
+	e, _ := newTestEngine()
+	e.HandleCommand("ucinewgame")
+	e.HandleCommand("position fen r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3")
+	// without the random part of the evaluation, both searches see the same tree and only the table differs
+	e.game.noise.max = 0
+	MakeMove(3, e.game)
+	firstNodes := e.game.timer.nodes
+	if entry, found := transpositionTable.probe(e.game.position.hash); !found || entry.depth != 3 || !entry.hasMove() {
+		t.Errorf("expected the root to be stored, got %+v", entry)
+	}
+
+	MakeMove(3, e.game)
+	if e.game.timer.nodes >= firstNodes {
+		t.Errorf("expected fewer nodes when searching again, got %d and %d", firstNodes, e.game.timer.nodes)
+	}
+
+	e.HandleCommand("setoption name Hash value 1")
+	if len(transpositionTable.entries) != len(NewTranspositionTable(1).entries) {
+		t.Errorf("expected the Hash option to resize the table")
+	}
+	e.HandleCommand("setoption name Hash value 16")
+}
@@ -1,30 +1,58 @@
 package chess
 
 import (
+	"bytes"
+	"regexp"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 func setup() {
-	Debug = true
 	TreeDepth = 2
 }
 
+// newTestEngine returns an engine that writes its responses to out
+func newTestEngine() (*UCIEngine, *bytes.Buffer) {
+	out := new(bytes.Buffer)
+	return NewUCIEngine(out), out
+}
+
+func outputLines(out *bytes.Buffer) []string {
+	return strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+}
+
+func lastLine(out *bytes.Buffer) string {
+	lines := outputLines(out)
+	return lines[len(lines)-1]
+}
+
+// bestMove returns the move of the bestmove line the search ended with, without its ponder move
+func bestMove(out *bytes.Buffer) string {
+	if fields := strings.Fields(lastLine(out)); len(fields) > 1 && fields[0] == "bestmove" {
+		return fields[1]
+	}
+	return ""
+}
+
 // TestUCIEngine simulates creating a game and making several moves
 func TestUCIEngine(t *testing.T) {
 	setup()
 	RandomSeed = 1722630608576018000
 
-	var game *Game
+	e, out := newTestEngine()
 	var finished bool
-	game, finished = HandleUciCommand("ucinewgame", game)
+	finished = e.HandleCommand("ucinewgame")
 	//look there is a bug
 	//cmd := "position startpos moves d2d4 e7e6 c2c4 d8h4 g2g3 f8b4 b1c3 h4e4 g1f3 b8c6 f1g2 d7d5 e1g1 b4c3 b2c3 e4f5 d1d3 f5d3 e2d3 d5c4 d3c4 g8f6 f1e1 e8g8 c1a3 f8d8 a1d1 h7h6 f3e5 c6e5 e1e5 f6g4 e5e1 f7f5 d4d5 e6d5 c4d5 g4f6 a3e7 d8e8 e7f6 e8e1 d1e1 g7f6 e1e7 c7c5 d5d6 g8f8 g2d5 h6h5 h2h4 a7a6 e7h7 f8e8 d5f7 e8d7 f7h5 d7d6 h5f3 a8a7 c3c4 c8e6 h7b7 a7b7 f3b7 e6c4 a2a3 d6c7 b7f3 c4f7 h4h5 c5c4 g1f1 c4c3 f1e2 f7h5 f3h5 f5f4 g3f4 a6a5 e2d3 f6f5 d3c3 c7b7 c3c4 b7a8 c4b5 a5a4 b5a4 a8b8 a4b5 b8a7 b5c5 a7a8 c5d5 a8b8 d5e5 b8b7 e5f5 b7c7 f5e6 c7c8 f4f5 c8b8 f5f6 b8c7 f6f7 c7c8 f7f8q\n"
 
 	cmd := "position startpos moves e2e4 e7e5 b1c3 b8c6 f1c4 d7d5 e4d5 c6d4 c3e4 f8b4 c2c3 b4c3 d2c3 d4f5 c4b5 e8f8 c3c4 f5h4 g2g3 h4g2 e1f1 g2e3 c1e3 a7a5 e3c5 g8e7 c5e7 f8e7 f1e1 c8f5 d5d6 c7d6 e4c3 h8f8 c3d5 e7e6 g1f3 e5e4 f3d4 e6e5 f2f4\n"
-	game, finished = HandleUciCommand(cmd, game)
-	game, finished = HandleUciCommand("go infinite", game)
+	finished = e.HandleCommand(cmd)
+	finished = e.HandleCommand("go")
+	e.waitSearch()
 
-	lastCommand := commandsSentToUCI[len(commandsSentToUCI)-1]
+	lastCommand := lastLine(out)
 	println(lastCommand)
 
 	if finished {
@@ -35,11 +63,11 @@ func TestUCIEngine(t *testing.T) {
 
 func TestValidKingMovesUnderCheck(t *testing.T) {
 	setup()
-	var game *Game
-	game, _ = HandleUciCommand("ucinewgame", game)
-	game, _ = HandleUciCommand("position startpos moves e2e4 e7e5 f1b5 c7c6 b5c4 d7d5 e4d5 c6d5 c4b5 e8e7 d1f3 f7f5 f3a3 e7e6 a3e3 e6f7 e3e5 c8d7 e5d5 f7f6 d5d4 f6f7 b5c4 d7e6 c4e6", game)
+	e, _ := newTestEngine()
+	e.HandleCommand("ucinewgame")
+	e.HandleCommand("position startpos moves e2e4 e7e5 f1b5 c7c6 b5c4 d7d5 e4d5 c6d5 c4b5 e8e7 d1f3 f7f5 f3a3 e7e6 a3e3 e6f7 e3e5 c8d7 e5d5 f7f6 d5d4 f6f7 b5c4 d7e6 c4e6")
 
-	moves := game.position.GetAllMoves()
+	moves := e.game.position.GetAllMoves()
 
 	if len(moves) != 4 {
 		t.Errorf("Expected 4 moves in this position, got %d", len(moves))
@@ -49,11 +77,11 @@ func TestValidKingMovesUnderCheck(t *testing.T) {
 
 func TestValidMovesForStartingPosition(t *testing.T) {
 	setup()
-	var game *Game
-	game, _ = HandleUciCommand("ucinewgame", game)
-	game, _ = HandleUciCommand("position startpos moves e2e4 e7e5", game)
+	e, _ := newTestEngine()
+	e.HandleCommand("ucinewgame")
+	e.HandleCommand("position startpos moves e2e4 e7e5")
 
-	moves := game.position.GetAllMoves()
+	moves := e.game.position.GetAllMoves()
 
 	if len(moves) != 29 {
 		t.Errorf("Expected 29 moves in this position, got %d", len(moves))
@@ -62,13 +90,14 @@ func TestValidMovesForStartingPosition(t *testing.T) {
 
 func TestMatInOne(t *testing.T) {
 	setup()
-	var game *Game
-	game, _ = HandleUciCommand("ucinewgame", game)
-	game, _ = HandleUciCommand("position startpos moves e2e4 e7e5 f1c4 f8c5 d1h5 g8f6", game)
-	game, _ = HandleUciCommand("go infinite", game)
-
-	lastCommand := commandsSentToUCI[len(commandsSentToUCI)-1]
-	if lastCommand != "bestmove h5f7\n" {
+	e, out := newTestEngine()
+	e.HandleCommand("ucinewgame")
+	e.HandleCommand("position startpos moves e2e4 e7e5 f1c4 f8c5 d1h5 g8f6")
+	e.HandleCommand("go")
+	e.waitSearch()
+
+	lastCommand := bestMove(out)
+	if lastCommand != "h5f7" {
 		t.Errorf("The engine didn't find a mate in 1")
 	}
 
@@ -76,38 +105,40 @@ func TestMatInOne(t *testing.T) {
 
 func TestCheckEscape(t *testing.T) {
 	setup()
-	var game *Game
-	game, _ = HandleUciCommand("ucinewgame", game)
-	game, _ = HandleUciCommand("position startpos moves f2f4 e7e6 c2c4 d8h4", game)
-	game, _ = HandleUciCommand("go infinite", game)
-
-	lastCommand := commandsSentToUCI[len(commandsSentToUCI)-1]
-	if lastCommand != "bestmove g2g3\n" {
+	e, out := newTestEngine()
+	e.HandleCommand("ucinewgame")
+	e.HandleCommand("position startpos moves f2f4 e7e6 c2c4 d8h4")
+	e.HandleCommand("go")
+	e.waitSearch()
+
+	lastCommand := bestMove(out)
+	if lastCommand != "g2g3" {
 		t.Errorf("The engine didn't escape a check")
 	}
 }
 
 func TestFreePieceCapture(t *testing.T) {
 	setup()
-	var game *Game
-	game, _ = HandleUciCommand("ucinewgame", game)
-	game, _ = HandleUciCommand("position startpos moves f2f4 e7e6 e2e4 d8g5", game)
-	game, _ = HandleUciCommand("go infinite", game)
-
-	lastCommand := commandsSentToUCI[len(commandsSentToUCI)-1]
-	if lastCommand != "bestmove f4g5\n" {
+	e, out := newTestEngine()
+	e.HandleCommand("ucinewgame")
+	e.HandleCommand("position startpos moves f2f4 e7e6 e2e4 d8g5")
+	e.HandleCommand("go")
+	e.waitSearch()
+
+	lastCommand := bestMove(out)
+	if lastCommand != "f4g5" {
 		t.Errorf("The engine didn't capture a free piece")
 	}
 }
 
 func TestZobristHashing(t *testing.T) {
 	setup()
-	var game *Game
-	game, _ = HandleUciCommand("ucinewgame", game)
-	game, _ = HandleUciCommand("position startpos", game)
-	positionHash := ComputeZobristHash(game.position)
+	e, _ := newTestEngine()
+	e.HandleCommand("ucinewgame")
+	e.HandleCommand("position startpos")
+	positionHash := ComputeZobristHash(e.game.position)
 	moves := []string{"e2e4", "e7e5", "g1f3", "b8c6", "f3e5", "c6e5"}
-	p := &game.position
+	p := &e.game.position
 	for _, moveStr := range moves {
 		move := parseMove(moveStr, *p)
 		newHash := UpdateZobristHash(positionHash, &move, *p)
@@ -127,42 +158,245 @@ func TestZobristHashing(t *testing.T) {
 
 func TestThreeFoldRepetition(t *testing.T) {
 	setup()
-	var game *Game
-	game, _ = HandleUciCommand("ucinewgame", game)
-	game, _ = HandleUciCommand("position startpos moves g1f3 b8c6 f3g1 c6b8 g1f3 b8c6 f3g1 c6b8", game)
-	prevPosition := game.position
-
-	game, _ = HandleUciCommand("position startpos moves g1f3 b8c6 f3g1 c6b8 g1f3 b8c6 f3g1 c6b8 g1f3", game)
+	e, _ := newTestEngine()
+	e.HandleCommand("ucinewgame")
+	e.HandleCommand("position startpos moves g1f3 b8c6 f3g1 c6b8")
+	if e.game.IsThreeFoldRepetition() {
+		t.Errorf("The starting position occurred only twice")
+	}
 
-	evaluation := game.position.Evaluate(prevPosition, game.GetLastMove(), game.positionHashes)
+	e.HandleCommand("position startpos moves g1f3 b8c6 f3g1 c6b8 g1f3 b8c6 f3g1 c6b8")
+	if !e.game.IsThreeFoldRepetition() {
+		t.Errorf("The starting position occurred three times")
+	}
 
-	if evaluation != ColorFactor(game.GetLastMove().isWhite)*ThreeFoldRepetitionEvalution {
-		t.Errorf("The evaluation should be a three fold repetition evaluation, %f", evaluation)
+	e.HandleCommand("position startpos moves g1f3 b8c6 f3g1 c6b8 e2e4 e7e5 g1f3 b8c6 f3g1 c6b8")
+	if e.game.IsThreeFoldRepetition() {
+		t.Errorf("The pawn moves made the earlier positions unreachable")
 	}
 }
 
 func TestEnPassant(t *testing.T) {
 	setup()
-	var game *Game
-	game, _ = HandleUciCommand("ucinewgame", game)
-	game, _ = HandleUciCommand("position startpos moves f2f4 h7h6 f4f5 f7f6 g2g4 g7g5", game)
-	game, _ = HandleUciCommand("go infinite", game)
-
-	lastCommand := commandsSentToUCI[len(commandsSentToUCI)-1]
-	if lastCommand != "bestmove f5g6\n" {
+	e, out := newTestEngine()
+	e.HandleCommand("ucinewgame")
+	e.HandleCommand("position startpos moves f2f4 h7h6 f4f5 f7f6 g2g4 g7g5")
+	e.HandleCommand("go")
+	e.waitSearch()
+
+	lastCommand := bestMove(out)
+	if lastCommand != "f5g6" {
 		t.Errorf("The engine didn't capture a free piece")
 	}
 }
 
 func TestEnPassantBlack(t *testing.T) {
 	setup()
-	var game *Game
-	game, _ = HandleUciCommand("ucinewgame", game)
-	game, _ = HandleUciCommand("position startpos moves h2h4 f7f5 f2f3 f5f4 g2g4", game)
-	game, _ = HandleUciCommand("go infinite", game)
-
-	lastCommand := commandsSentToUCI[len(commandsSentToUCI)-1]
-	if lastCommand != "bestmove f4g3\n" {
+	e, out := newTestEngine()
+	e.HandleCommand("ucinewgame")
+	e.HandleCommand("position startpos moves h2h4 f7f5 f2f3 f5f4 g2g4")
+	e.HandleCommand("go")
+	e.waitSearch()
+
+	lastCommand := bestMove(out)
+	if lastCommand != "f4g3" {
 		t.Errorf("The engine didn't capture a free piece")
 	}
 }
+
+func TestFiftyMoveRule(t *testing.T) {
+	setup()
+	e, _ := newTestEngine()
+	e.HandleCommand("ucinewgame")
+	e.HandleCommand("position fen 8/8/8/4k3/8/8/8/KQ6 w - - 99 80")
+	e.HandleCommand("go")
+	e.waitSearch()
+
+	if !e.game.isFinished || e.game.result != 0 {
+		t.Errorf("The game should be drawn by the fifty-move rule")
+	}
+
+	position, _ := ParseFEN("8/8/8/4k3/8/8/8/KQ6 b - - 100 80")
+	if eval := position.Evaluate(); eval != 0 {
+		t.Errorf("The position should be evaluated as a draw, got %d", eval)
+	}
+}
+
+func TestInsufficientMaterialEndsGame(t *testing.T) {
+	setup()
+	e, _ := newTestEngine()
+	e.HandleCommand("ucinewgame")
+	e.HandleCommand("position fen 8/8/4k3/8/8/3KB3/8/8 w - - 0 60")
+	e.HandleCommand("go")
+	e.waitSearch()
+
+	if !e.game.isFinished || e.game.result != 0 {
+		t.Errorf("The game should be drawn by insufficient material")
+	}
+}
+
+func TestMateScore(t *testing.T) {
+	setup()
+	e, out := newTestEngine()
+	e.HandleCommand("ucinewgame")
+	e.HandleCommand("position fen 6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1")
+	e.HandleCommand("go")
+	e.waitSearch()
+
+	if !slices.ContainsFunc(outputLines(out), func(line string) bool {
+		return strings.HasPrefix(line, "info depth 1 ") && strings.Contains(line, " score mate 1 ")
+	}) {
+		t.Errorf("expected a mate in 1 score, got %v", outputLines(out))
+	}
+	if lastCommand := bestMove(out); lastCommand != "a1a8" {
+		t.Errorf("The engine didn't play the mate in 1, got %s", lastCommand)
+	}
+	if !e.game.isFinished || e.game.result != 1 {
+		t.Errorf("expected white to win, finished: %t, result: %d", e.game.isFinished, e.game.result)
+	}
+}
+
+func TestUCIScore(t *testing.T) {
+	tests := []struct {
+		eval      Score
+		whiteTurn bool
+		expected  string
+	}{
+		{50, true, "cp 50"},
+		{50, false, "cp -50"},
+		{getCheckmateEvaluationAt(false, 1), true, "mate 1"},
+		{getCheckmateEvaluationAt(false, 3), true, "mate 2"},
+		{getCheckmateEvaluationAt(false, 2), false, "mate -1"},
+		{getCheckmateEvaluationAt(true, 4), true, "mate -2"},
+		{getCheckmateEvaluationAt(true, 0), true, "mate 0"},
+	}
+	for _, tt := range tests {
+		if got := uciScore(tt.eval, tt.whiteTurn); got != tt.expected {
+			t.Errorf("uciScore(%d, %t): expected %s, got %s", tt.eval, tt.whiteTurn, tt.expected, got)
+		}
+	}
+}
+
+func TestStopSearch(t *testing.T) {
+	setup()
+	e, out := newTestEngine()
+	e.HandleCommand("ucinewgame")
+	e.HandleCommand("position startpos moves e2e4 e7e5")
+	// a search of about 20 seconds
+	e.HandleCommand("go wtime 600000 btime 600000")
+	time.Sleep(50 * time.Millisecond)
+	e.HandleCommand("isready")
+
+	start := time.Now()
+	if e.HandleCommand("stop") {
+		t.Errorf("stop shouldn't exit the engine")
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("the search took %v to stop", took)
+	}
+
+	lines := outputLines(out)
+	ready := slices.Index(lines, "readyok")
+	if ready == -1 || !strings.HasPrefix(lines[len(lines)-1], "bestmove ") {
+		t.Fatalf("expected readyok during the search and a bestmove after stop, got %v", lines)
+	}
+	move := e.game.GetLastMove()
+	if move == nil || bestMove(out) != moveToUCI(*move) {
+		t.Errorf("expected the bestmove to be played in the game, got %v", lines[len(lines)-1])
+	}
+
+	// the engine goes on with the next command
+	e.HandleCommand("isready")
+	if lastCommand := lastLine(out); lastCommand != "readyok" {
+		t.Errorf("expected readyok after stop, got %s", lastCommand)
+	}
+	e.HandleCommand("stop")
+	if lastCommand := lastLine(out); lastCommand != "readyok" {
+		t.Errorf("expected no bestmove without a search, got %s", lastCommand)
+	}
+}
+
+func TestQuitDuringSearch(t *testing.T) {
+	setup()
+	e, out := newTestEngine()
+	e.HandleCommand("ucinewgame")
+	e.HandleCommand("position startpos")
+	e.HandleCommand("go wtime 600000 btime 600000")
+	if !e.HandleCommand("quit") {
+		t.Errorf("quit should exit the engine")
+	}
+	if e.done != nil || !strings.HasPrefix(lastLine(out), "bestmove ") {
+		t.Errorf("expected the search to be over, got %s", lastLine(out))
+	}
+}
+
+func TestInfoLines(t *testing.T) {
+	setup()
+	TreeDepth = 4
+	e, out := newTestEngine()
+	e.HandleCommand("ucinewgame")
+	e.HandleCommand("position startpos moves e2e4 e7e5")
+	e.HandleCommand("go")
+	e.waitSearch()
+
+	info := regexp.MustCompile(`^info depth (\d+) seldepth (\d+) score cp -?\d+ nodes (\d+) nps \d+ time \d+ hashfull \d+ pv( [a-h][1-8][a-h][1-8][qrbn]?)+$`)
+	lines := outputLines(out)
+	depth, nodes := 0, 0
+	var pv string
+	for _, line := range lines[:len(lines)-1] {
+		// slow runs report the root moves too
+		if strings.HasPrefix(line, "info currmove ") {
+			continue
+		}
+		match := info.FindStringSubmatch(line)
+		if match == nil {
+			t.Fatalf("unexpected line %q", line)
+		}
+		if atoi(match[1]) != depth+1 || atoi(match[2]) < atoi(match[1]) || atoi(match[3]) <= nodes {
+			t.Errorf("expected the next depth with more nodes and a selective depth at least as deep, got %q", line)
+		}
+		depth, nodes = atoi(match[1]), atoi(match[3])
+		pv = strings.Fields(line[strings.Index(line, " pv ")+4:])[0]
+	}
+	if depth != 4 || bestMove(out) != pv {
+		t.Errorf("expected 4 iterations and the bestmove of the last principal variation, got %v", lines)
+	}
+}
+
+func TestPonder(t *testing.T) {
+	setup()
+	e, out := newTestEngine()
+	e.HandleCommand("position startpos moves e2e4 e7e5")
+	e.HandleCommand("go depth 3")
+	e.waitSearch()
+	lines := outputLines(out)
+	pv := strings.Fields(lines[len(lines)-2][strings.Index(lines[len(lines)-2], " pv ")+4:])
+	if expected := "bestmove " + pv[0] + " ponder " + pv[1]; lastLine(out) != expected {
+		t.Errorf("expected %s, got %s", expected, lastLine(out))
+	}
+
+	// the time limits apply from ponderhit on, with the time spent pondering already counted
+	e.HandleCommand("position startpos moves e2e4 e7e5 " + pv[0] + " " + pv[1])
+	e.HandleCommand("go ponder wtime 100 btime 100")
+	time.Sleep(200 * time.Millisecond)
+	select {
+	case <-e.done:
+		t.Fatalf("a ponder search shouldn't send its bestmove before ponderhit")
+	default:
+	}
+	start := time.Now()
+	e.HandleCommand("ponderhit")
+	e.waitSearch()
+	if took := time.Since(start); took > 100*time.Millisecond || bestMove(out) == "" {
+		t.Errorf("expected a bestmove right after ponderhit, got %s after %v", lastLine(out), took)
+	}
+
+	// stop during ponder still sends a move
+	e.HandleCommand("position startpos moves e2e4 e7e5 " + pv[0] + " " + pv[1])
+	e.HandleCommand("go ponder wtime 60000 btime 60000")
+	time.Sleep(50 * time.Millisecond)
+	e.HandleCommand("stop")
+	if e.done != nil || bestMove(out) == "" {
+		t.Errorf("expected a bestmove after stop, got %s", lastLine(out))
+	}
+}
@@ -0,0 +1,181 @@
+package chess
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The types of the UCI options
+const (
+	optionSpin   = "spin"
+	optionCheck  = "check"
+	optionString = "string"
+	optionCombo  = "combo"
+	optionButton = "button"
+)
+
+// maxMultiPV bounds the MultiPV option
+const maxMultiPV = 64
+
+// uciOption is an option of the engine, declared in the response to the uci command and set by setoption
+type uciOption struct {
+	name string
+	kind string
+	def  string
+	// min and max bound a spin option, vars are the values of a combo option
+	min, max int
+	vars     []string
+	// set applies a valid value of the option to the engine, buttons get an empty value
+	set func(e *UCIEngine, value string)
+}
+
+var uciOptions = []uciOption{
+	{name: "Hash", kind: optionSpin, def: strconv.Itoa(DefaultHashSizeMB), min: 1, max: 4096, set: func(e *UCIEngine, value string) {
+		HashSizeMB = atoi(value)
+		transpositionTable = NewTranspositionTable(HashSizeMB)
+	}},
+	{name: "Clear Hash", kind: optionButton, set: func(e *UCIEngine, value string) {
+		transpositionTable.Clear()
+	}},
+	{name: "Threads", kind: optionSpin, def: "1", min: 1, max: maxThreads, set: func(e *UCIEngine, value string) {
+		e.threads = atoi(value)
+	}},
+	{name: "Depth", kind: optionSpin, def: strconv.Itoa(TreeDepth), min: 1, max: maxSearchDepth, set: func(e *UCIEngine, value string) {
+		e.depth = atoi(value)
+	}},
+	{name: "MultiPV", kind: optionSpin, def: "1", min: 1, max: maxMultiPV, set: func(e *UCIEngine, value string) {
+		e.multiPV = atoi(value)
+	}},
+	{name: "Randomness", kind: optionSpin, def: strconv.Itoa(int(DefaultRandomness)), min: 0, max: int(PawnScore), set: func(e *UCIEngine, value string) {
+		e.randomness = Score(atoi(value))
+	}},
+	// the GUI ponders with go ponder once the option is on, the engine itself has nothing to set
+	{name: "Ponder", kind: optionCheck, def: "false", set: func(e *UCIEngine, value string) {}},
+	{name: "OwnBook", kind: optionCheck, def: strconv.FormatBool(OwnBook), set: func(e *UCIEngine, value string) {
+		OwnBook = value == "true"
+	}},
+	{name: "Book", kind: optionString, def: "<empty>", set: func(e *UCIEngine, value string) {
+		setBookFile(value)
+	}},
+	{name: "LogFile", kind: optionString, def: "<empty>", set: func(e *UCIEngine, value string) {
+		e.setLogFile(value)
+	}},
+	{name: "NullMovePruning", kind: optionCheck, def: strconv.FormatBool(NullMovePruning), set: func(e *UCIEngine, value string) {
+		NullMovePruning = value == "true"
+	}},
+	{name: "LateMoveReductions", kind: optionCheck, def: strconv.FormatBool(LateMoveReductions), set: func(e *UCIEngine, value string) {
+		LateMoveReductions = value == "true"
+	}},
+	{name: "FutilityPruning", kind: optionCheck, def: strconv.FormatBool(FutilityPruning), set: func(e *UCIEngine, value string) {
+		FutilityPruning = value == "true"
+	}},
+}
+
+// declaration is the option line of the response to the uci command
+func (o *uciOption) declaration() string {
+	line := fmt.Sprintf("option name %s type %s", o.name, o.kind)
+	switch o.kind {
+	case optionSpin:
+		line += fmt.Sprintf(" default %s min %d max %d", o.def, o.min, o.max)
+	case optionCombo:
+		line += " default " + o.def
+		for _, v := range o.vars {
+			line += " var " + v
+		}
+	case optionCheck, optionString:
+		line += " default " + o.def
+	}
+	return line
+}
+
+// validate returns the value to set the option to, and false when the value doesn't fit the type of the option
+func (o *uciOption) validate(value string) (string, bool) {
+	switch o.kind {
+	case optionSpin:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return "", false
+		}
+		return strconv.Itoa(min(max(n, o.min), o.max)), true
+	case optionCheck:
+		return value, value == "true" || value == "false"
+	case optionCombo:
+		i := slices.IndexFunc(o.vars, func(v string) bool { return strings.EqualFold(v, value) })
+		if i == -1 {
+			return "", false
+		}
+		return o.vars[i], true
+	case optionButton:
+		return "", true
+	}
+	return value, true
+}
+
+func findOption(name string) *uciOption {
+	for i := range uciOptions {
+		if strings.EqualFold(uciOptions[i].name, name) {
+			return &uciOptions[i]
+		}
+	}
+	return nil
+}
+
+// handleSetOption handles "setoption name <id> [value <x>]", the value is left out for buttons
+func (e *UCIEngine) handleSetOption(command string) {
+	parts := strings.Fields(command)
+	if len(parts) < 3 || parts[1] != "name" {
+		log.Println("Invalid command: ", command)
+		return
+	}
+	valueIndex := slices.Index(parts, "value")
+	if valueIndex == -1 {
+		valueIndex = len(parts)
+	}
+	name := strings.Join(parts[2:valueIndex], " ")
+	value := ""
+	if valueIndex < len(parts) {
+		value = strings.Join(parts[valueIndex+1:], " ")
+	}
+
+	option := findOption(name)
+	if option == nil {
+		log.Println("Unknown option: ", name)
+		return
+	}
+	value, ok := option.validate(value)
+	if !ok {
+		log.Println("Invalid value of option", option.name, ":", value)
+		return
+	}
+	option.set(e, value)
+}
+
+// setLogFile sends the log to the file, which is appended to, or discards it when there is no file
+func (e *UCIEngine) setLogFile(path string) {
+	e.closeLog()
+	if path == "" || path == "<empty>" {
+		log.SetOutput(io.Discard)
+		return
+	}
+	logFile, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		log.SetOutput(io.Discard)
+		e.output.send(fmt.Sprintf("info string failed to open the log file: %v", err))
+		return
+	}
+	e.logFile = logFile
+	log.SetOutput(logFile)
+}
+
+func (e *UCIEngine) closeLog() {
+	if e.logFile != nil {
+		log.SetOutput(io.Discard)
+		e.logFile.Close()
+		e.logFile = nil
+	}
+}
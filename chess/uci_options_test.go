@@ -0,0 +1,130 @@
+package chess
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDeclareOptions(t *testing.T) {
+	e, out := newTestEngine()
+	e.HandleCommand("uci")
+
+	lines := outputLines(out)
+	expected := []string{
+		"option name Hash type spin default 16 min 1 max 4096",
+		"option name Clear Hash type button",
+		"option name Threads type spin default 1 min 1 max 512",
+		"option name MultiPV type spin default 1 min 1 max 64",
+		"option name Randomness type spin default 20 min 0 max 100",
+		"option name OwnBook type check default true",
+		"option name Book type string default <empty>",
+		"option name LogFile type string default <empty>",
+	}
+	for _, line := range expected {
+		if !slices.Contains(lines, line) {
+			t.Errorf("expected %q in %v", line, lines)
+		}
+	}
+	if !slices.ContainsFunc(lines, func(line string) bool { return strings.HasPrefix(line, "option name Depth type spin default ") }) {
+		t.Errorf("expected the Depth option in %v", lines)
+	}
+	if lines[len(lines)-1] != "uciok" {
+		t.Errorf("expected uciok last, got %s", lines[len(lines)-1])
+	}
+}
+
+func TestSetOption(t *testing.T) {
+	e, _ := newTestEngine()
+	e.HandleCommand("setoption name depth value 3")
+	e.HandleCommand("setoption name Threads value 1000")
+	e.HandleCommand("setoption name Randomness value 0")
+	e.HandleCommand("setoption name MultiPV value two")
+	e.HandleCommand("setoption name Unknown value 1")
+	if e.depth != 3 || e.threads != maxThreads || e.randomness != 0 || e.multiPV != 1 {
+		t.Errorf("expected depth 3, %d threads, no randomness and 1 line, got %d, %d, %d and %d",
+			maxThreads, e.depth, e.threads, e.randomness, e.multiPV)
+	}
+
+	e.HandleCommand("ucinewgame")
+	e.HandleCommand("position startpos")
+	e.HandleCommand("setoption name Threads value 1")
+	e.HandleCommand("go")
+	e.waitSearch()
+	if len(e.game.bestMoveSequence) < 3 || e.game.noise.max != 0 {
+		t.Errorf("expected a search of depth 3 without randomness, got %v", e.game.bestMoveSequence)
+	}
+
+	transpositionTable.store(1, 1, boundExact, 0, nil)
+	e.HandleCommand("setoption name Clear Hash")
+	if _, found := transpositionTable.probe(1); found {
+		t.Errorf("expected the Clear Hash button to clear the table")
+	}
+}
+
+func TestMultiPV(t *testing.T) {
+	setup()
+	e, out := newTestEngine()
+	e.HandleCommand("setoption name MultiPV value 3")
+	e.HandleCommand("ucinewgame")
+	e.HandleCommand("position fen r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	e.HandleCommand("go")
+	e.waitSearch()
+
+	info := regexp.MustCompile(`^info depth (\d+) seldepth \d+ multipv (\d+) score cp (-?\d+) .* pv (\S+)`)
+	lines := outputLines(out)
+	firstMoves := map[int][]string{}
+	scores := map[int][]int{}
+	for _, line := range lines[:len(lines)-1] {
+		// slow runs report the root moves too
+		if strings.HasPrefix(line, "info currmove ") {
+			continue
+		}
+		match := info.FindStringSubmatch(line)
+		if match == nil {
+			t.Fatalf("unexpected line %q", line)
+		}
+		depth := atoi(match[1])
+		if atoi(match[2]) != len(firstMoves[depth])+1 {
+			t.Errorf("expected the lines in order, got %q", line)
+		}
+		firstMoves[depth] = append(firstMoves[depth], match[4])
+		scores[depth] = append(scores[depth], atoi(match[3]))
+	}
+
+	last := firstMoves[TreeDepth]
+	if len(last) != 3 || last[0] == last[1] || last[0] == last[2] || last[1] == last[2] {
+		t.Errorf("expected 3 lines with different moves, got %v", last)
+	}
+	if !slices.IsSortedFunc(scores[TreeDepth], func(a, b int) int { return b - a }) {
+		t.Errorf("expected the best line first, got %v", scores[TreeDepth])
+	}
+	if bestMove(out) != last[0] {
+		t.Errorf("expected the move of the first line, got %s", lines[len(lines)-1])
+	}
+}
+
+func TestLogFile(t *testing.T) {
+	defer log.SetOutput(os.Stderr)
+	path := filepath.Join(t.TempDir(), "engine.log")
+
+	e, _ := newTestEngine()
+	e.HandleCommand("setoption name LogFile value " + path)
+	e.HandleCommand("isready")
+	e.HandleCommand("quit")
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "readyok") {
+		t.Errorf("expected the output in the log, got %q", content)
+	}
+	if e.logFile != nil {
+		t.Errorf("expected quit to close the log file")
+	}
+}
@@ -2,24 +2,29 @@ package chess
 
 import (
 	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"runtime/debug"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 )
 
-var commandsSentToUCI []string
+// maxThreads bounds the Threads option
+const maxThreads = 512
 
-func StartUCI() {
+// OwnBook enables the opening book set by the Book option
+var OwnBook = true
+var BookFile = ""
+var openingBook *Book
 
-	logFile, err := os.OpenFile("/Users/artg/dev/chess-engine/build/uci_engine.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
-	if err != nil {
-		log.Fatalf("Failed to open log file: %v", err)
-	}
-	defer logFile.Close()
-
-	log.SetOutput(logFile)
+// StartUCI runs the engine on the standard input and output, it logs to the file of the LogFile option
+func StartUCI() {
+	log.SetOutput(io.Discard)
 
 	defer func() {
 		if r := recover(); r != nil {
@@ -27,69 +32,132 @@ func StartUCI() {
 		}
 	}()
 
-	reader := bufio.NewReader(os.Stdin)
-	var game *Game
+	// the searches run in their own goroutine, so stop and quit are read while searching
+	scanner := bufio.NewScanner(os.Stdin)
+	engine := NewUCIEngine(os.Stdout)
 
-	for {
-		text, _ := reader.ReadString('\n')
-		text = strings.TrimSpace(text)
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
 		log.Printf("Received: %s\n", text)
 
-		var isFinished bool
-		game, isFinished = HandleUciCommand(text, game)
-		if isFinished {
+		if engine.HandleCommand(text) {
 			return
 		}
 	}
+	// the GUI closed the input
+	engine.HandleCommand("quit")
+}
+
+// UCIEngine is a UCI session: the game the GUI set up, the options that apply to its searches and the
+// output the responses are written to
+type UCIEngine struct {
+	output *uciOutput
+	game   *Game
+	// debug is switched by the debug command, it prints the principal variations of the search
+	debug bool
+	// the options of the searches, see uciOptions
+	threads    int
+	depth      int
+	multiPV    int
+	randomness Score
+	logFile    *os.File
+
+	// cancel stops the running search, done is closed once it sent its bestmove
+	cancel context.CancelFunc
+	done   chan struct{}
+	// ponderhit is the channel of the running ponder search, closed by the ponderhit command
+	ponderhit chan struct{}
+}
+
+func NewUCIEngine(w io.Writer) *UCIEngine {
+	return &UCIEngine{output: &uciOutput{w: w}, threads: 1, depth: TreeDepth, multiPV: 1, randomness: DefaultRandomness}
 }
 
-func HandleUciCommand(commandText string, game *Game) (*Game, bool) {
-	//commandText = strings.TrimSuffix(commandText, "\n")
+// HandleCommand handles a command of the GUI, and returns true when the engine should exit.
+// The go command returns while the search goes on, the commands that change the game or the options
+// stop it first.
+func (e *UCIEngine) HandleCommand(commandText string) bool {
 	switch {
 	case commandText == "uci":
-		handleUCI()
+		e.handleUCI()
 	case commandText == "isready":
-		handleIsReady()
+		e.output.send("readyok")
+	case strings.HasPrefix(commandText, "debug"):
+		e.debug = strings.TrimSpace(strings.TrimPrefix(commandText, "debug")) == "on"
 	case commandText == "ucinewgame":
-		game = handleUCINewGame()
+		e.stopSearch()
+		e.game = handleUCINewGame()
+	case strings.HasPrefix(commandText, "setoption"):
+		e.stopSearch()
+		e.handleSetOption(commandText)
 	case strings.HasPrefix(commandText, "position"):
-		game = handlePosition(commandText)
+		e.stopSearch()
+		e.game = handlePosition(commandText, e.game)
 	case strings.HasPrefix(commandText, "go"):
-		handleGo(game)
+		e.stopSearch()
+		e.handleGo(commandText)
+	case commandText == "ponderhit":
+		e.ponderHit()
 	case commandText == "stop":
-		handleStop(game)
-		return game, true
+		e.stopSearch()
 	case commandText == "quit":
-		handleQuit(game)
-		return game, true
+		e.stopSearch()
+		e.closeLog()
+		return true
 	default:
 		// Handle other commands
 	}
-	return game, false
+	return false
 }
 
-func handleUCI() {
-	sendToUCI("id name SimpleButCuteChessEngine")
-	sendToUCI("id author Art")
-	sendToUCI("uciok")
+// uciOutput writes the responses to the GUI, one line at a time, from the search threads too
+type uciOutput struct {
+	mu sync.Mutex
+	w  io.Writer
 }
 
-func sendToUCI(cmd string) {
+// send writes the line to the GUI, a nil output discards it
+func (o *uciOutput) send(cmd string) {
+	if o == nil {
+		return
+	}
 	log.Println("Output: ", cmd)
-	fmt.Println(cmd)
-	commandsSentToUCI = append(commandsSentToUCI, cmd)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	fmt.Fprintln(o.w, cmd)
 }
 
-func handleIsReady() {
-	sendToUCI("readyok")
+func (e *UCIEngine) handleUCI() {
+	e.output.send("id name SimpleButCuteChessEngine")
+	e.output.send("id author Art")
+	for i := range uciOptions {
+		e.output.send(uciOptions[i].declaration())
+	}
+	e.output.send("uciok")
+}
+
+func setBookFile(path string) {
+	BookFile = path
+	openingBook = nil
+	if path == "" || path == "<empty>" {
+		return
+	}
+	book, err := OpenBook(path)
+	if err != nil {
+		log.Println("Failed to open book:", err)
+		return
+	}
+	openingBook = book
 }
 
 func handleUCINewGame() *Game {
-	return NewGame()
+	game := NewGame()
+	transpositionTable.Clear()
+	return game
 }
 
-func handlePosition(command string) *Game {
-	parts := strings.Split(command, " ")
+func handlePosition(command string, currentGame *Game) *Game {
+	parts := strings.Fields(command)
 	if len(parts) < 2 {
 		println("Invalid command: ", command)
 		os.Exit(1)
@@ -97,105 +165,205 @@ func handlePosition(command string) *Game {
 
 	var game = NewGame()
 
-	if parts[1] == "startpos" {
+	movesIndex := slices.Index(parts, "moves")
+	if movesIndex == -1 {
+		movesIndex = len(parts)
 	}
 
-	if parts[1] == "fen" && len(parts) > 2 {
-		fenString := strings.Join(parts[2:], " ")
-		fenInfo := parseFEN(fenString)
-		game.InitGame(&fenInfo.Board, fenInfo.WhiteTurn, TreeDepth)
+	if parts[1] == "fen" {
+		fenString := strings.Join(parts[2:movesIndex], " ")
+		position, err := ParseFEN(fenString)
+		if err != nil {
+			log.Println("Invalid FEN:", err)
+			return currentGame
+		}
+		game.InitGameFromPosition(position, TreeDepth)
 	}
 
 	// Apply moves if any
-	if len(parts) > 2 {
-		moveIndex := 2
-		if parts[1] == "fen" {
-			moveIndex = 7 // Skips the FEN parts
-		}
-		if parts[moveIndex] == "moves" {
-			for i := moveIndex + 1; i < len(parts); i++ {
-				move := parseMove(parts[i], game.position)
-				ApplyMovePointers(game.position, &move)
-				game.moves = append(game.moves, move)
-				game.position.hash = ComputeZobristHash(game.position)
-				game.positionHashes[game.position.hash] = true
-			}
-		}
+	for i := movesIndex + 1; i < len(parts); i++ {
+		move := parseMove(parts[i], game.position)
+		ApplyMovePointers(game.position, &move)
+		game.moves = append(game.moves, move)
+		game.position.hash = ComputeZobristHash(game.position)
+		game.history.push(game.position.hash)
 	}
 	game.position.PrintPosition()
-	log.Println("FEN: ", game.position.positionToFEN())
+	log.Println("FEN: ", game.position.FEN())
 	return game
 }
 
-type FENInfo struct {
-	Board           [8][8]string
-	WhiteTurn       bool
-	CastlingRights  string
-	EnPassantSquare string
-	HalfmoveClock   int
-	FullmoveNumber  int
-}
-
-func parseFEN(fen string) FENInfo {
-	parts := strings.Split(fen, " ")
-	board := fenToBoard(parts[0])
-	activeColor := parts[1]
-	whiteTurn := false
-	if activeColor == "w" {
-		whiteTurn = true
-	}
-	castlingRights := parts[2]
-	enPassantSquare := parts[3]
-	halfmoveClock := atoi(parts[4])
-	fullmoveNumber := atoi(parts[5])
-
-	return FENInfo{
-		Board:           board,
-		WhiteTurn:       whiteTurn,
-		CastlingRights:  castlingRights,
-		EnPassantSquare: enPassantSquare,
-		HalfmoveClock:   halfmoveClock,
-		FullmoveNumber:  fullmoveNumber,
-	}
-}
-
-func fenToBoard(fen string) [8][8]string {
-	var board [8][8]string
-	ranks := strings.Split(fen, "/")
-	for i, rank := range ranks {
-		file := 0
-		for _, char := range rank {
-			if char >= '1' && char <= '8' {
-				for k := 0; k < int(char-'0'); k++ {
-					board[i][file] = ""
-					file++
-				}
-			} else {
-				board[i][file] = string(char)
-				file++
-			}
-		}
-	}
-	return board
-}
-
 func atoi(s string) int {
 	var n int
 	fmt.Sscanf(s, "%d", &n)
 	return n
 }
 
-func handleGo(game *Game) {
-	game.MakeMove()
-	move := *game.GetLastMove()
-	uciMove := moveToUCI(move)
+func (e *UCIEngine) handleGo(command string) {
+	game := e.game
+	game.output = e.output
+	game.debug = e.debug
+	game.threads = e.threads
+	game.treeDepth = e.depth
+	game.multiPV = e.multiPV
+	game.noise.max = e.randomness
+
+	parts := strings.Fields(command)
+	if len(parts) > 2 && parts[1] == "perft" {
+		handlePerft(game, atoi(parts[2]))
+		return
+	}
+
+	game.limits = parseSearchLimits(parts, game.position)
+	game.ponderhit = nil
+	if game.limits.Ponder {
+		game.ponderhit = make(chan struct{})
+	}
+	e.ponderhit = game.ponderhit
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	e.cancel, e.done = cancel, done
+	go func() {
+		defer close(done)
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("UNHANDLED PANIC in search: %v\n%s", r, debug.Stack())
+			}
+		}()
+		search(ctx, game)
+	}()
+}
+
+// search plays the move of the book or of the search in the game, and sends it as the bestmove with the reply
+// it expects to ponder on. An infinite search holds its bestmove back until the GUI stops it, a ponder search
+// until the ponderhit command too.
+func search(ctx context.Context, game *Game) {
+	movesBefore := len(game.moves)
+	// the book doesn't know about searchmoves
+	useBook := OwnBook && openingBook != nil && len(game.limits.SearchMoves) == 0
+	if !useBook || !game.MakeBookMove(openingBook) {
+		game.MakeMoveContext(ctx)
+	}
+	if game.limits.Infinite {
+		<-ctx.Done()
+	}
+	if game.ponderhit != nil {
+		select {
+		case <-ctx.Done():
+		case <-game.ponderhit:
+		}
+	}
+	if len(game.moves) == movesBefore {
+		// the game is over, there is no move to play
+		game.output.send("bestmove 0000")
+		return
+	}
+	uciMove := moveToUCI(*game.GetLastMove())
 
 	str := "Best Sequence: "
 	for _, bestMove := range game.bestMoveSequence {
 		str += fmt.Sprintf("%s, ", bestMove)
 	}
 	log.Println(str)
-	sendToUCI("bestmove " + uciMove + "\n")
+	if len(game.bestMoveSequence) > 1 {
+		uciMove += " ponder " + moveToUCI(*game.bestMoveSequence[1])
+	}
+	game.output.send("bestmove " + uciMove)
+}
+
+// ponderHit tells the running ponder search that the opponent played the expected move, it goes on as a normal
+// search from there, its time limits counting from the start of the pondering
+func (e *UCIEngine) ponderHit() {
+	if e.ponderhit == nil {
+		return
+	}
+	close(e.ponderhit)
+	e.ponderhit = nil
+}
+
+// stopSearch ends the running search, if any, once it sent its bestmove
+func (e *UCIEngine) stopSearch() {
+	if e.cancel == nil {
+		return
+	}
+	e.cancel()
+	e.waitSearch()
+}
+
+// waitSearch waits for the running search, if any, to end by itself
+func (e *UCIEngine) waitSearch() {
+	if e.done == nil {
+		return
+	}
+	<-e.done
+	e.cancel()
+	e.cancel, e.done, e.ponderhit = nil, nil, nil
+}
+
+// goParameters are the parameters of the go command, they end the list of searchmoves
+var goParameters = []string{"searchmoves", "ponder", "wtime", "btime", "winc", "binc", "movestogo", "depth", "nodes", "mate", "movetime", "infinite"}
+
+// parseSearchLimits reads the limits of the go command, searchmoves that aren't legal in the position are left out
+func parseSearchLimits(parts []string, p *Position) SearchLimits {
+	var limits SearchLimits
+	for i := 1; i < len(parts); i++ {
+		switch parts[i] {
+		case "infinite":
+			limits.Infinite = true
+			continue
+		case "ponder":
+			limits.Ponder = true
+			continue
+		case "searchmoves":
+			for i+1 < len(parts) && !slices.Contains(goParameters, parts[i+1]) {
+				i++
+				if move, ok := findLegalMove(parts[i], p); ok {
+					limits.SearchMoves = append(limits.SearchMoves, move)
+				}
+			}
+			continue
+		}
+		if i+1 == len(parts) {
+			break
+		}
+
+		value := atoi(parts[i+1])
+		millis := time.Duration(value) * time.Millisecond
+		switch parts[i] {
+		case "wtime":
+			limits.WhiteTime = millis
+		case "btime":
+			limits.BlackTime = millis
+		case "winc":
+			limits.WhiteInc = millis
+		case "binc":
+			limits.BlackInc = millis
+		case "movestogo":
+			limits.MovesToGo = value
+		case "movetime":
+			limits.MoveTime = millis
+		case "depth":
+			limits.Depth = value
+		case "nodes":
+			limits.Nodes = uint64(max(value, 0))
+		case "mate":
+			limits.Mate = value
+		default:
+			continue
+		}
+		i++
+	}
+	return limits
+}
+
+// findLegalMove finds the legal move of the position written in UCI notation
+func findLegalMove(uciMove string, p *Position) (Move, bool) {
+	for _, move := range p.GetAllMoves() {
+		if moveToUCI(move) == uciMove {
+			return move, true
+		}
+	}
+	return Move{}, false
 }
 
 func moveToUCI(m Move) string {
@@ -207,12 +375,45 @@ func moveToUCI(m Move) string {
 	return uciMove
 }
 
-func handleStop(game *Game) {
-	game.isFinished = true
+// currMoveDelay is how long the search goes before it reports the root move it searches
+const currMoveDelay = time.Second
+
+// infoLine reports a principal variation of a completed iteration of the search, line numbers it with MultiPV
+func (g *Game) infoLine(depth int, line int, eval Score, pv []*Move) string {
+	elapsed := g.timer.elapsed()
+	nodes := g.timer.totalNodes()
+	nps := uint64(float64(nodes) / max(elapsed.Seconds(), 0.001))
+
+	multiPV := ""
+	if g.multiPV > 1 {
+		multiPV = fmt.Sprintf(" multipv %d", line)
+	}
+	info := fmt.Sprintf("info depth %d seldepth %d%s score %s nodes %d nps %d time %d hashfull %d pv",
+		depth, g.selDepth, multiPV, uciScore(eval, g.position.whiteTurn), nodes, nps, elapsed.Milliseconds(), transpositionTable.hashFull())
+	for _, move := range pv {
+		info += " " + moveToUCI(*move)
+	}
+	return info
 }
 
-func handleQuit(game *Game) {
-	game.isFinished = true
+// sendCurrMove reports the root move the search starts on, once the search takes long enough for it to matter
+func (g *Game) sendCurrMove(move *Move, number int) {
+	if g.output != nil && g.timer.elapsed() >= currMoveDelay {
+		g.output.send(fmt.Sprintf("info currmove %s currmovenumber %d", moveToUCI(*move), number))
+	}
+}
+
+// uciScore formats an evaluation for white as the score of the side to move: "mate N" with N moves to the
+// checkmate, negative when the side to move is checkmated, or "cp N" in centipawns
+func uciScore(eval Score, whiteTurn bool) string {
+	if IsCheckmateEvaluation(eval) {
+		plies := checkmatePlies(eval)
+		if sideEval(eval, whiteTurn) > 0 {
+			return fmt.Sprintf("mate %d", (plies+1)/2)
+		}
+		return fmt.Sprintf("mate %d", -plies/2)
+	}
+	return fmt.Sprintf("cp %d", sideEval(eval, whiteTurn))
 }
 
 func parseMove(moveStr string, p *Position) Move {
@@ -234,7 +435,8 @@ func parseMove(moveStr string, p *Position) Move {
 		m.pawnPromotePiece = PieceStrToPieceBit(pawnPromotePiece)
 	}
 
-	if piece == PawnBit && !m.isCapture && m.fromCol != m.toCol {
+	fromPiece, _ := getPiece(m.fromRow, m.fromCol, p)
+	if fromPiece == PawnBit && !m.isCapture && m.fromCol != m.toCol {
 		m.isCapture = true
 		m.isEnPassant = true
 	}
@@ -1,7 +1,6 @@
 package chess
 
 import (
-	"log"
 	"math/rand"
 )
 
@@ -12,41 +11,134 @@ const (
 	blackTurn = 0
 )
 
+// castling rights as bits, see Position.castlingRights
+const (
+	whiteShortCastle = uint8(1)
+	whiteLongCastle  = uint8(2)
+	blackShortCastle = uint8(4)
+	blackLongCastle  = uint8(8)
+)
+
 // Zobrist table
 var zobristTable [boardSize][boardSize][numPieces]uint64
 var zobristTurn [2]uint64
+
+// zobristCastling holds the xor of the keys of every combination of castling rights
+var zobristCastling [16]uint64
+
+// zobristEnPassant is indexed by the column of the pawn that can be captured en passant
+var zobristEnPassant [boardSize]uint64
 var zobristUp = false
 
+// zobristSeed generates the zobrist keys
+const zobristSeed = 20240802
+
+// castlingRightsLost holds the castling rights lost when a piece moves from or to the square
+var castlingRightsLost = [64]uint8{
+	0:  whiteLongCastle,
+	4:  whiteShortCastle | whiteLongCastle,
+	7:  whiteShortCastle,
+	56: blackLongCastle,
+	60: blackShortCastle | blackLongCastle,
+	63: blackShortCastle,
+}
+
 // InitZobrist Initialize Zobrist table
 func InitZobrist() {
 	if zobristUp {
 		return
 	}
+	// the keys don't depend on the random seed of the games, so that every game hashes the same way
+	r := rand.New(rand.NewSource(zobristSeed))
 	for i := 0; i < boardSize; i++ {
 		for j := 0; j < boardSize; j++ {
 			for k := 0; k < numPieces; k++ {
-				zobristTable[i][j][k] = rand.Uint64()
+				zobristTable[i][j][k] = r.Uint64()
+			}
+		}
+	}
+	zobristTurn[whiteTurn] = r.Uint64()
+	zobristTurn[blackTurn] = r.Uint64()
+
+	var castlingKeys [4]uint64
+	for i := range castlingKeys {
+		castlingKeys[i] = r.Uint64()
+	}
+	for rights := range zobristCastling {
+		for i, key := range castlingKeys {
+			if rights&(1<<i) != 0 {
+				zobristCastling[rights] ^= key
 			}
 		}
 	}
-	zobristTurn[whiteTurn] = rand.Uint64()
-	zobristTurn[blackTurn] = rand.Uint64()
+	for i := range zobristEnPassant {
+		zobristEnPassant[i] = r.Uint64()
+	}
 	zobristUp = true
 }
 
+func zobristPieceKey(row, col uint8, piece uint8, isWhite bool) uint64 {
+	return zobristTable[row][col][pieceIndex(piece)+6*colorIndex(isWhite)]
+}
+
+func (p *Position) castlingRights() uint8 {
+	rights := uint8(0)
+	if p.whiteShortCastleAllowed {
+		rights |= whiteShortCastle
+	}
+	if p.whiteLongCastleAllowed {
+		rights |= whiteLongCastle
+	}
+	if p.blackShortCastleAllowed {
+		rights |= blackShortCastle
+	}
+	if p.blackLongCastleAllowed {
+		rights |= blackLongCastle
+	}
+	return rights
+}
+
+// enPassantCol returns the column of the pawn that just made a double step, if a pawn of the side to move
+// stands next to it. Otherwise en passant isn't possible and the position is the same as without the double step.
+func (p *Position) enPassantCol() (uint8, bool) {
+	if p.whiteTurn {
+		return enPassantColIfCapturable(p, p.blackPawnDoubleStepCol, 4, true)
+	}
+	return enPassantColIfCapturable(p, p.whitePawnDoubleStepCol, 3, false)
+}
+
+func enPassantColIfCapturable(p *Position, col uint8, row uint8, capturingWhite bool) (uint8, bool) {
+	if col == noDoubleStep {
+		return 0, false
+	}
+	neighbours := uint64(0)
+	if col > 0 {
+		neighbours |= squareBit(row, col-1)
+	}
+	if col < 7 {
+		neighbours |= squareBit(row, col+1)
+	}
+	return col, p.piecesOf(PawnBit, capturingWhite)&neighbours != 0
+}
+
 func ComputeZobristHash(pos *Position) uint64 {
 	var hash uint64
 
 	// Hash the board pieces
 	for i := uint8(0); i < boardSize; i++ {
 		for j := uint8(0); j < boardSize; j++ {
-			piece, _ := getPiece(i, j, pos)
+			piece, isWhite := getPiece(i, j, pos)
 			if piece != 0 {
-				hash ^= zobristTable[i][j][allPieceIndexes[piece]]
+				hash ^= zobristPieceKey(i, j, piece, isWhite)
 			}
 		}
 	}
 
+	hash ^= zobristCastling[pos.castlingRights()]
+	if col, ok := pos.enPassantCol(); ok {
+		hash ^= zobristEnPassant[col]
+	}
+
 	// Hash the turn
 	if pos.whiteTurn {
 		hash ^= zobristTurn[whiteTurn]
@@ -57,39 +149,59 @@ func ComputeZobristHash(pos *Position) uint64 {
 	return hash
 }
 
-// UpdateZobristHash updates the Zobrist hash based on a given move
+// UpdateZobristHash updates the Zobrist hash of the position based on a move that wasn't applied to it yet
 func UpdateZobristHash(hash uint64, move *Move, pos *Position) uint64 {
-	if move == nil {
-		log.Println("Art debug")
-	}
 	fromPiece, _ := getPiece(move.fromRow, move.fromCol, pos)
-	toPiece, _ := getPiece(move.toRow, move.toCol, pos)
+	toPiece, toWhite := getPiece(move.toRow, move.toCol, pos)
 
 	// Remove the piece from the source square
-	hash ^= zobristTable[move.fromRow][move.fromCol][allPieceIndexes[fromPiece]]
+	hash ^= zobristPieceKey(move.fromRow, move.fromCol, fromPiece, move.isWhite)
 
-	// If the move is a capture, remove the captured piece from the target square
-	if move.isCapture {
-		hash ^= zobristTable[move.toRow][move.toCol][allPieceIndexes[toPiece]]
+	// If the move is a capture, remove the captured piece from the target square, or from next to it on en passant
+	if move.isEnPassant {
+		hash ^= zobristPieceKey(move.fromRow, move.toCol, PawnBit, !move.isWhite)
+	} else if toPiece != 0 {
+		hash ^= zobristPieceKey(move.toRow, move.toCol, toPiece, toWhite)
 	}
 
 	// Add the piece to the target square
 	if move.pawnPromotePiece != 0 {
 		// If it's a pawn promotion, add the promoted piece to the target square
-		hash ^= zobristTable[move.toRow][move.toCol][allPieceIndexes[move.pawnPromotePiece]]
+		hash ^= zobristPieceKey(move.toRow, move.toCol, move.pawnPromotePiece & ^isWhiteBit, move.isWhite)
 	} else {
 		// Otherwise, add the moved piece to the target square
-		hash ^= zobristTable[move.toRow][move.toCol][allPieceIndexes[fromPiece]]
+		hash ^= zobristPieceKey(move.toRow, move.toCol, fromPiece, move.isWhite)
 	}
 
-	// Switch the turn
-	if move.isWhite {
-		hash ^= zobristTurn[whiteTurn]
-		hash ^= zobristTurn[blackTurn]
-	} else {
-		hash ^= zobristTurn[blackTurn]
-		hash ^= zobristTurn[whiteTurn]
+	// Move the rook when castling
+	if fromPiece == KingBit && absDiff(move.fromCol, move.toCol) > 1 {
+		rookFromCol, rookToCol := uint8(7), uint8(5)
+		if move.toCol < move.fromCol {
+			rookFromCol, rookToCol = 0, 3
+		}
+		hash ^= zobristPieceKey(move.fromRow, rookFromCol, RookBit, move.isWhite)
+		hash ^= zobristPieceKey(move.fromRow, rookToCol, RookBit, move.isWhite)
 	}
 
+	// Update the castling rights
+	rights := pos.castlingRights()
+	from := squareIndex(move.fromRow, move.fromCol)
+	to := squareIndex(move.toRow, move.toCol)
+	hash ^= zobristCastling[rights] ^ zobristCastling[rights & ^(castlingRightsLost[from]|castlingRightsLost[to])]
+
+	// The en passant possibility of the previous move expires, and a double step may create a new one
+	if col, ok := pos.enPassantCol(); ok {
+		hash ^= zobristEnPassant[col]
+	}
+	if fromPiece == PawnBit && absDiff(move.fromRow, move.toRow) == 2 {
+		if col, ok := enPassantColIfCapturable(pos, move.toCol, move.toRow, !move.isWhite); ok {
+			hash ^= zobristEnPassant[col]
+		}
+	}
+
+	// Switch the turn
+	hash ^= zobristTurn[whiteTurn]
+	hash ^= zobristTurn[blackTurn]
+
 	return hash
 }
@@ -0,0 +1,66 @@
+package chess
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestIncrementalZobristHashInRandomGames(t *testing.T) {
+	InitZobrist()
+	r := rand.New(rand.NewSource(1))
+
+	for _, tt := range perftPositions {
+		for game := 0; game < 20; game++ {
+			p, err := ParseFEN(tt.fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.hash = ComputeZobristHash(p)
+			startHash := p.hash
+
+			plies := 0
+			for ; plies < 200; plies++ {
+				moves := p.GetAllMoves()
+				if len(moves) == 0 {
+					break
+				}
+				move := moves[r.Intn(len(moves))]
+				p.MakeMove(&move)
+				if p.hash != ComputeZobristHash(p) {
+					t.Fatalf("%s: incremental hash differs from the computed one after %s, FEN %s", tt.name, move.String(), p.FEN())
+				}
+			}
+
+			for ; plies > 0; plies-- {
+				p.UnmakeMove()
+			}
+			if p.hash != startHash {
+				t.Fatalf("%s: hash wasn't restored after unmaking all the moves", tt.name)
+			}
+		}
+	}
+}
+
+func TestZobristHashDistinguishesCastlingAndEnPassant(t *testing.T) {
+	InitZobrist()
+	fens := []string{
+		"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1",
+		"r3k2r/8/8/8/8/8/8/R3K2R w Kkq - 0 1",
+		"r3k2r/8/8/8/8/8/8/R3K2R w - - 0 1",
+		"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1",
+		"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1",
+		"4k3/8/8/3pP3/8/8/8/4K3 w - - 0 1",
+	}
+	hashes := make(map[uint64]string)
+	for _, fen := range fens {
+		p, err := ParseFEN(fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash := ComputeZobristHash(p)
+		if other, exists := hashes[hash]; exists {
+			t.Errorf("%q and %q have the same hash", fen, other)
+		}
+		hashes[hash] = fen
+	}
+}